@@ -5,16 +5,57 @@ import (
 	gfx "github.com/crabmusket/lowrezjam2017/graphics"
 	obj "github.com/crabmusket/lowrezjam2017/obj"
 	tex "github.com/crabmusket/lowrezjam2017/tex"
+	watch "github.com/crabmusket/lowrezjam2017/watch"
 	"github.com/go-gl/gl/v3.2-core/gl"
 	mgl "github.com/go-gl/mathgl/mgl32"
 	"strconv"
 )
 
+// Pixels of wrapped border around each image in an atlas, which also limits
+// how far it can be mipmapped.
+const atlasPadding = 8
+
+// How many lights the static shader has room for, as POINT_LIGHT_COUNT.
+const pointLightCount = 6
+
+// The names of each light's uniforms, which are built once rather than every
+// frame.
+type pointLightUniforms struct{
+	position string
+	diffuseColour string
+	radius string
+}
+
+var pointLightNames = makePointLightNames()
+
+func makePointLightNames() []pointLightUniforms {
+	names := make([]pointLightUniforms, pointLightCount)
+	for i := range(names) {
+		prefix := "pointLights[" + strconv.Itoa(i) + "]."
+		names[i] = pointLightUniforms{
+			position: prefix + "position",
+			diffuseColour: prefix + "diffuseColour",
+			radius: prefix + "radius",
+		}
+	}
+	return names
+}
+
+// Simplified versions of the level, and how far away to start drawing them.
+var LevelDetail = []obj.LODLevel{
+	obj.LODLevel{Ratio: 0.5, Distance: 10},
+	obj.LODLevel{Ratio: 0.25, Distance: 25},
+}
+
 type Scene struct{
 	Camera *Camera
 	Level *StaticRendered
-	Textures tex.Library
+	Textures *tex.Library
 	Lights []*Light
+	Watcher *watch.Watcher
+
+	// Keys of the textures each object holds a reference to.
+	heldTextures map[*obj.Object][]string
 }
 
 type Camera struct{
@@ -28,7 +69,9 @@ type Camera struct{
 type StaticRendered struct{
 	Transform mgl.Mat4
 	Geometry *obj.Object
-	Shader uint32
+	// Optional simplified versions of Geometry for drawing from far away.
+	LOD *obj.LODSet
+	Shader *gfx.Shader
 }
 
 type Light struct{
@@ -37,52 +80,44 @@ type Light struct{
 	Radius float32
 }
 
-var (
-	textures = []string{
-		"resources/textures/wall_stone.png",
-		"resources/textures/wall_plain.png",
-		"resources/textures/roof_wood.png",
-		"resources/textures/floor_tiled.png",
-	}
-)
+// Assets are reloaded when they change if watcher isn't nil. With useAtlas, the
+// level's textures are packed into one atlas.
+func BuildScene(watcher *watch.Watcher, strict bool, useAtlas bool) (*Scene, error) {
+	library := tex.MakeLibrary(watcher)
 
-func BuildScene(watch bool) (*Scene, error) {
-	library := tex.MakeLibrary()
+	level1, warnings, err := obj.LoadBaked("resources/meshes/floor1.obj", "resources/meshes/floor1.obj.baked", obj.Options{Strict: strict, Tangents: true})
+	if err != nil {
+		return nil, err
+	}
+	PrintWarnings(warnings)
+	fmt.Printf("%v: %v vertices from %v face corners\n", level1.Filename, level1.Stats.Vertices, level1.Stats.Corners)
 
-	for _, file := range(textures) {
-		texture, err := tex.Load(file, library)
+	if watcher != nil {
+		err := level1.Watch(watcher)
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		if watch {
-			err := texture.Watch()
-			if err != nil {
-				return nil, err
-			}
+	if useAtlas {
+		err := buildAtlas(level1, watcher)
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	level1, warnings, err := obj.Load("resources/meshes/floor1.obj")
+	staticShader, err := gfx.LoadShader("resources/shaders/static.vert.glsl", "resources/shaders/static.frag.glsl", obj.AttributeNames...)
 	if err != nil {
 		return nil, err
 	}
-	for _, warning := range warnings {
-		fmt.Printf("%+v\n", warning)
-	}
 
-	if watch {
-		err := level1.Watch()
+	if watcher != nil {
+		err := staticShader.Watch(watcher)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	staticShader, err := gfx.MakeProgram("resources/shaders/static.vert.glsl", "resources/shaders/static.frag.glsl")
-	if err != nil {
-		return nil, err
-	}
-
 	scene := &Scene{
 		Camera: &Camera{
 			Position: mgl.Vec3{0, 0, 0},
@@ -112,34 +147,171 @@ func BuildScene(watch bool) (*Scene, error) {
 		},
 
 		Textures: library,
+		Watcher: watcher,
+		heldTextures: make(map[*obj.Object][]string),
 	}
 
+	if !useAtlas {
+		err := scene.LoadTextures(level1)
+		if err != nil {
+			return nil, err
+		}
+	}
+	scene.Level.BuildLOD(LevelDetail)
+
 	return scene, nil
 }
 
+// Print anything more serious than SeverityInfo.
+func PrintWarnings(warnings []*obj.Warning) {
+	for _, warning := range warnings {
+		if warning.Severity > obj.SeverityInfo {
+			fmt.Println(warning.String())
+		}
+	}
+}
+
+// Take a reference to each diffuse texture and normal map named by an object's
+// material libraries, then release the ones it held before, so that textures a
+// reloaded object stopped using are deleted. If a texture can't be loaded the
+// object keeps the ones it had.
+func (self Scene) LoadTextures(object *obj.Object) error {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, material := range object.Materials {
+		if material.Description == nil {
+			continue
+		}
+		for _, filename := range []string{material.Description.DiffuseMap, material.Description.BumpMap} {
+			key := tex.Key(filename)
+			if filename == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			_, err := self.Textures.Load(filename)
+			if err != nil {
+				self.releaseTextures(keys)
+				return err
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	self.releaseTextures(self.heldTextures[object])
+	self.heldTextures[object] = keys
+	return nil
+}
+
+// Bring an object's textures up to date after it's reloaded. An object drawn
+// from an atlas has the atlas applied again as it's reloaded, so it has no
+// textures of its own to load.
+func (self Scene) ReloadTextures(object *obj.Object) error {
+	if object.Atlas != nil {
+		return nil
+	}
+	return self.LoadTextures(object)
+}
+
+func (self Scene) releaseTextures(keys []string) {
+	for _, key := range keys {
+		self.Textures.Release(key)
+	}
+}
+
+// Pack an object's diffuse textures into an atlas and draw it from that.
+func buildAtlas(object *obj.Object, watcher *watch.Watcher) error {
+	var filenames []string
+	seen := make(map[string]bool)
+	for _, material := range object.Materials {
+		if material.Description == nil || material.Description.DiffuseMap == "" {
+			continue
+		}
+		if seen[material.TextureName()] {
+			continue
+		}
+		seen[material.TextureName()] = true
+		filenames = append(filenames, material.Description.DiffuseMap)
+	}
+
+	atlas, err := tex.BuildAtlas(filenames, atlasPadding)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("packed %v textures into a %vx%v atlas\n", len(filenames), atlas.Size.X, atlas.Size.Y)
+
+	err = object.UseAtlas(atlas)
+	if err != nil {
+		return err
+	}
+	object.Unbind()
+	object.Bind()
+
+	if watcher != nil {
+		return atlas.Watch(watcher)
+	}
+	return nil
+}
+
 func (self Scene) Render() {
-	program := self.Level.Shader
-	gl.UseProgram(program)
+	program := self.Level.Shader.Program
+	program.Use()
+	gl.Uniform1i(program.Uniform("textureMap"), 0)
+	gl.Uniform1i(program.Uniform("normalMap"), 1)
 
 	// Lighting
-	gl.Uniform1f(gl.GetUniformLocation(program, gl.Str("ambient\x00")), 0.05)
+	gl.Uniform1f(program.Uniform("ambient"), 0.05)
 	for i, light := range(self.Lights) {
-		if i > 5 {
+		if i >= pointLightCount {
 			break
 		}
-		is := strconv.Itoa(i)
-		gl.Uniform3f(gl.GetUniformLocation(program, gl.Str("pointLights[" + is + "].position\x00")), light.Position[0], light.Position[1], light.Position[2])
-		gl.Uniform3f(gl.GetUniformLocation(program, gl.Str("pointLights[" + is + "].diffuseColour\x00")), light.Colour[0], light.Colour[1], light.Colour[2])
-		gl.Uniform1f(gl.GetUniformLocation(program, gl.Str("pointLights[" + is + "].radius\x00")), light.Radius)
+		names := pointLightNames[i]
+		gl.Uniform3f(program.Uniform(names.position), light.Position[0], light.Position[1], light.Position[2])
+		gl.Uniform3f(program.Uniform(names.diffuseColour), light.Colour[0], light.Colour[1], light.Colour[2])
+		gl.Uniform1f(program.Uniform(names.radius), light.Radius)
 	}
 
 	// Transforms
-	gl.UniformMatrix4fv(gl.GetUniformLocation(program, gl.Str("projection\x00")), 1, false, &self.Camera.Projection[0])
-	gl.UniformMatrix4fv(gl.GetUniformLocation(program, gl.Str("view\x00")), 1, false, &self.Camera.Transform[0])
+	gl.UniformMatrix4fv(program.Uniform("projection"), 1, false, &self.Camera.Projection[0])
+	gl.UniformMatrix4fv(program.Uniform("view"), 1, false, &self.Camera.Transform[0])
 	p := self.Camera.Position;
-	gl.Uniform3f(gl.GetUniformLocation(program, gl.Str("cameraPos\x00")), p[0], p[1], p[2])
+	gl.Uniform3f(program.Uniform("cameraPos"), p[0], p[1], p[2])
+
+	// Render the level, moving each part by its own transform
+	geometry := self.Level.GeometryFrom(self.Camera.Position)
+	useAtlas := int32(0)
+	if geometry.Atlas != nil {
+		useAtlas = 1
+	}
+	gl.Uniform1i(program.Uniform("useAtlas"), useAtlas)
+	model := program.Uniform("model")
+	geometry.RenderEach(self.Textures, func(part *obj.Part) {
+		transform := self.Level.Transform.Mul4(part.Transform)
+		gl.UniformMatrix4fv(model, 1, false, &transform[0])
+	})
+}
+
+// Simplify Geometry into levels of detail, replacing any there were. This has
+// to be done again whenever Geometry is reloaded.
+func (self *StaticRendered) BuildLOD(levels []obj.LODLevel) {
+	if self.LOD != nil {
+		self.LOD.Unbind()
+	}
+	self.LOD = obj.MakeLODSet(self.Geometry, levels)
+}
+
+// The geometry to draw when seen from a point, picking a level of detail by
+// how far the point is from the object's bounding sphere.
+func (self StaticRendered) GeometryFrom(point mgl.Vec3) *obj.Object {
+	if self.LOD == nil {
+		return self.Geometry
+	}
+
+	bounds := self.Geometry.Bounds.Transform(self.Transform)
+	distance := bounds.Center.Sub(point).Len() - bounds.Radius
+	if distance < 0 {
+		distance = 0
+	}
 
-	// Render the level
-	gl.UniformMatrix4fv(gl.GetUniformLocation(program, gl.Str("model\x00")), 1, false, &self.Level.Transform[0])
-	self.Level.Geometry.Render(self.Textures)
+	return self.LOD.Select(distance)
 }
@@ -17,7 +17,7 @@ const (
 type Renderer struct{
 	Window *glfw.Window
 	Version string
-	Shader uint32
+	Shader *Shader
 	Framebuffer uint32
 	Texture uint32
 	Plane uint32
@@ -49,7 +49,7 @@ func Init(width int, height int, title string) (*Renderer, error) {
 		return nil, err
 	}
 
-	screenShader, err := MakeProgram("resources/shaders/screen.vert.glsl", "resources/shaders/screen.frag.glsl")
+	screenShader, err := LoadShader("resources/shaders/screen.vert.glsl", "resources/shaders/screen.frag.glsl", "pos", "tex")
 	if err != nil {
 		return nil, err
 	}
@@ -77,23 +77,47 @@ func Terminate() {
 	defer glfw.Terminate()
 }
 
-func MakeProgram(vert string, frag string) (uint32, error) {
+// Attributes are bound to locations in the order they're given, so the
+// program matches the vertex arrays it'll be drawn with.
+func MakeProgram(vert string, frag string, attributes ...string) (*Program, error) {
 	vertexShader, err := compileShader(vert, gl.VERTEX_SHADER)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
+	defer gl.DeleteShader(vertexShader)
 
 	fragmentShader, err := compileShader(frag, gl.FRAGMENT_SHADER)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
+	defer gl.DeleteShader(fragmentShader)
 
 	program := gl.CreateProgram()
 	gl.AttachShader(program, vertexShader)
 	gl.AttachShader(program, fragmentShader)
+	for i, attribute := range(attributes) {
+		gl.BindAttribLocation(program, uint32(i), gl.Str(attribute + "\x00"))
+	}
 	gl.LinkProgram(program)
 
-	return program, nil
+	// The program keeps what it needs from the shaders once it's linked
+	gl.DetachShader(program, vertexShader)
+	gl.DetachShader(program, fragmentShader)
+
+	var status int32
+	gl.GetProgramiv(program, gl.LINK_STATUS, &status)
+
+	if status == gl.FALSE {
+		var logLength int32
+		gl.GetProgramiv(program, gl.INFO_LOG_LENGTH, &logLength)
+		log := strings.Repeat("\x00", int(logLength + 1))
+		gl.GetProgramInfoLog(program, logLength, nil, gl.Str(log))
+
+		gl.DeleteProgram(program)
+		return nil, fmt.Errorf("failed to link %v and %v: %v", vert, frag, strings.TrimRight(log, "\x00"))
+	}
+
+	return makeProgram(program), nil
 }
 
 func initOpenGL() error {
@@ -129,7 +153,12 @@ func (self Renderer) Render(renderScene func()) {
 	gl.Viewport(0, 0, int32(width), int32(height))
 	gl.Clear(gl.COLOR_BUFFER_BIT)
 	gl.Disable(gl.DEPTH_TEST)
-	gl.UseProgram(self.Shader)
+	self.Shader.Program.Use()
+	showBroken := int32(0)
+	if len(broken) > 0 {
+		showBroken = 1
+	}
+	gl.Uniform1i(self.Shader.Program.Uniform("broken"), showBroken)
 	gl.BindTexture(gl.TEXTURE_2D, self.Texture)
 	gl.BindVertexArray(self.Plane)
 	gl.DrawElements(gl.TRIANGLES, 6, gl.UNSIGNED_INT, nil)
@@ -161,8 +190,9 @@ func compileShader(filename string, vertexOrFragment uint32) (shader uint32, err
 		log := strings.Repeat("\x00", int(logLength + 1))
 		gl.GetShaderInfoLog(shader, logLength, nil, gl.Str(log))
 
+		gl.DeleteShader(shader)
 		shader = 0
-		err = fmt.Errorf("failed to compile %v: %v", filename, log)
+		err = fmt.Errorf("failed to compile %v:\n%v", filename, mapLog(filename, strings.TrimRight(log, "\x00")))
 	}
 
 	return
@@ -0,0 +1,128 @@
+package graphics
+
+import (
+	"fmt"
+	"github.com/go-gl/gl/v3.2-core/gl"
+	"strings"
+)
+
+// A linked shader program, along with everything it reads from outside.
+type Program struct{
+	Id uint32
+	Uniforms map[string]Variable
+	Attributes map[string]Variable
+
+	// Uniform locations by name, including ones the program doesn't have.
+	locations map[string]int32
+}
+
+// An active uniform or attribute. Size is the number of elements for arrays
+// and 1 otherwise.
+type Variable struct{
+	Name string
+	Type uint32
+	Size int32
+	Location int32
+}
+
+func makeProgram(id uint32) *Program {
+	program := &Program{
+		Id: id,
+		Uniforms: make(map[string]Variable),
+		Attributes: make(map[string]Variable),
+		locations: make(map[string]int32),
+	}
+
+	var count, maxLength int32
+	gl.GetProgramiv(id, gl.ACTIVE_UNIFORMS, &count)
+	gl.GetProgramiv(id, gl.ACTIVE_UNIFORM_MAX_LENGTH, &maxLength)
+	for i := int32(0); i < count; i += 1 {
+		variable := activeVariable(maxLength, func(length *int32, size *int32, kind *uint32, name *uint8) {
+			gl.GetActiveUniform(id, uint32(i), maxLength, length, size, kind, name)
+		})
+		variable.Location = gl.GetUniformLocation(id, gl.Str(variable.Name + "\x00"))
+		program.Uniforms[variable.Name] = variable
+		program.locations[variable.Name] = variable.Location
+	}
+
+	gl.GetProgramiv(id, gl.ACTIVE_ATTRIBUTES, &count)
+	gl.GetProgramiv(id, gl.ACTIVE_ATTRIBUTE_MAX_LENGTH, &maxLength)
+	for i := int32(0); i < count; i += 1 {
+		variable := activeVariable(maxLength, func(length *int32, size *int32, kind *uint32, name *uint8) {
+			gl.GetActiveAttrib(id, uint32(i), maxLength, length, size, kind, name)
+		})
+		variable.Location = gl.GetAttribLocation(id, gl.Str(variable.Name + "\x00"))
+		program.Attributes[variable.Name] = variable
+	}
+
+	return program
+}
+
+// Arrays are reported as their first element, like "lights[0]", but are
+// looked up by the array's name.
+func activeVariable(maxLength int32, get func(length *int32, size *int32, kind *uint32, name *uint8)) Variable {
+	var length, size int32
+	var kind uint32
+	name := make([]uint8, maxLength + 1)
+	get(&length, &size, &kind, &name[0])
+
+	variable := Variable{
+		Name: strings.TrimSuffix(string(name[:length]), "[0]"),
+		Type: kind,
+		Size: size,
+	}
+	return variable
+}
+
+func (self *Program) Use() {
+	gl.UseProgram(self.Id)
+}
+
+func (self *Program) Delete() {
+	gl.DeleteProgram(self.Id)
+	self.Id = 0
+}
+
+// The location of a uniform, looked up once and then remembered. Uniforms the
+// program doesn't have are -1, which OpenGL ignores, and are reported the
+// first time they're asked for since that usually means a typo or a uniform
+// the compiler optimised away.
+func (self *Program) Uniform(name string) int32 {
+	if location, ok := self.locations[name]; ok {
+		return location
+	}
+
+	location := gl.GetUniformLocation(self.Id, gl.Str(name + "\x00"))
+	if location < 0 {
+		fmt.Printf("program %v has no active uniform %v\n", self.Id, name)
+	}
+	self.locations[name] = location
+	return location
+}
+
+func (self Variable) String() string {
+	if self.Size > 1 {
+		return fmt.Sprintf("%v %v[%v]", TypeName(self.Type), self.Name, self.Size)
+	}
+	return fmt.Sprintf("%v %v", TypeName(self.Type), self.Name)
+}
+
+var typeNames = map[uint32]string{
+	gl.FLOAT: "float",
+	gl.FLOAT_VEC2: "vec2",
+	gl.FLOAT_VEC3: "vec3",
+	gl.FLOAT_VEC4: "vec4",
+	gl.INT: "int",
+	gl.BOOL: "bool",
+	gl.FLOAT_MAT3: "mat3",
+	gl.FLOAT_MAT4: "mat4",
+	gl.SAMPLER_2D: "sampler2D",
+}
+
+// The GLSL name of a uniform or attribute type.
+func TypeName(kind uint32) string {
+	if name, ok := typeNames[kind]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%x", kind)
+}
@@ -0,0 +1,156 @@
+package graphics
+
+import (
+	"fmt"
+	watch "github.com/crabmusket/lowrezjam2017/watch"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A program built from a pair of shader files, which can be rebuilt when they
+// change. If rebuilding fails the last program which worked keeps being used,
+// and Err says what went wrong.
+type Shader struct{
+	Program *Program
+	Vertex string
+	Fragment string
+	Attributes []string
+	Err error
+}
+
+// Shaders whose last reload failed. The screen is drawn with a red border
+// while there are any, so a broken shader is obvious even though the old one
+// is still running.
+var broken = make(map[*Shader]bool)
+
+func LoadShader(vert string, frag string, attributes ...string) (*Shader, error) {
+	program, err := MakeProgram(vert, frag, attributes...)
+	if err != nil {
+		return nil, err
+	}
+
+	shader := &Shader{
+		Program: program,
+		Vertex: vert,
+		Fragment: frag,
+		Attributes: attributes,
+	}
+
+	return shader, nil
+}
+
+// Rebuild the program from its files. You must call this function from the
+// main thread which is running opengl.
+func (self *Shader) Reload() error {
+	program, err := MakeProgram(self.Vertex, self.Fragment, self.Attributes...)
+	self.Err = err
+	if err != nil {
+		broken[self] = true
+		return err
+	}
+
+	delete(broken, self)
+	self.Program.Delete()
+	self.Program = program
+	return nil
+}
+
+type ShaderUpdate struct{
+	Shader *Shader
+	Err error
+}
+
+var (
+	updatesLock sync.Mutex
+	updates []*ShaderUpdate
+)
+
+// Shaders can only be compiled on the main thread, so all the watcher does is
+// note which ones need rebuilding.
+func (self *Shader) Watch(watcher *watch.Watcher) error {
+	reload := func(string) {
+		updatesLock.Lock()
+		defer updatesLock.Unlock()
+
+		for _, pending := range(updates) {
+			if pending.Shader == self {
+				return
+			}
+		}
+		updates = append(updates, &ShaderUpdate{Shader: self})
+	}
+
+	_, err := watcher.Watch(self.Vertex, reload)
+	if err != nil {
+		return err
+	}
+	_, err = watcher.Watch(self.Fragment, reload)
+	return err
+}
+
+func nextUpdate() *ShaderUpdate {
+	updatesLock.Lock()
+	defer updatesLock.Unlock()
+
+	if len(updates) == 0 {
+		return nil
+	}
+	update := updates[0]
+	updates = updates[1:]
+	return update
+}
+
+// Rebuild changed shaders until there are none left or budget has been spent,
+// calling report after each one. You must call this function from the main
+// thread which is running opengl.
+func ProcessUpdates(budget time.Duration, report func(*ShaderUpdate)) {
+	start := time.Now()
+
+	for {
+		update := nextUpdate()
+		if update == nil {
+			return
+		}
+
+		update.Err = update.Shader.Reload()
+
+		if report != nil {
+			report(update)
+		}
+
+		if time.Since(start) >= budget {
+			return
+		}
+	}
+}
+
+var (
+	// Mesa, Intel and AMD: "ERROR: 0:12: 'foo' : undeclared identifier"
+	mesaLogLine = regexp.MustCompile(`^\s*(ERROR|WARNING): \d+:(\d+): (.*)$`)
+	// NVIDIA: "0(12) : error C1008: undefined variable "foo""
+	nvidiaLogLine = regexp.MustCompile(`^\s*\d+\((\d+)\)\s*: (\w+)\s*(.*)$`)
+)
+
+// Rewrite a driver's compile log so each message starts with filename:line,
+// which editors and terminals can jump to.
+func mapLog(filename string, log string) string {
+	var lines []string
+	for _, line := range(strings.Split(log, "\n")) {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if match := mesaLogLine.FindStringSubmatch(line); match != nil {
+			line = fmt.Sprintf("%v:%v: %v: %v", filename, match[2], strings.ToLower(match[1]), match[3])
+		} else if match := nvidiaLogLine.FindStringSubmatch(line); match != nil {
+			line = fmt.Sprintf("%v:%v: %v %v", filename, match[1], match[2], match[3])
+		} else {
+			line = fmt.Sprintf("%v: %v", filename, line)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
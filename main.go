@@ -6,9 +6,11 @@ import (
 	game "github.com/crabmusket/lowrezjam2017/game"
 	obj "github.com/crabmusket/lowrezjam2017/obj"
 	tex "github.com/crabmusket/lowrezjam2017/tex"
+	watch "github.com/crabmusket/lowrezjam2017/watch"
 	flag "github.com/ogier/pflag"
 	"os"
 	"runtime/pprof"
+	"time"
 )
 
 const (
@@ -16,11 +18,18 @@ const (
 	VERSION = "#LOWREZJAM2017"
 	width = 320
 	height = 320
+
+	// Time to spend each frame applying reloaded assets
+	reloadBudget = 4 * time.Millisecond
 )
 
 var (
 	flagCpuProfile = flag.String("cpuprofile", "", "output CPU profile information to this file")
 	flagWatch = flag.Bool("watch", false, "watch texture and model files for live-reloading")
+	flagStrict = flag.Bool("strict", false, "refuse to load models with errors in them")
+	flagAtlas = flag.Bool("atlas", false, "pack the level's textures into one atlas")
+	flagPalette = flag.String("palette", "", "quantize textures to the colours in this .gpl, .hex or image file")
+	flagDither = flag.String("dither", "none", "how to dither quantized textures: none, ordered or floyd-steinberg")
 )
 
 func main() {
@@ -43,7 +52,41 @@ func main() {
 
 	fmt.Println("OpenGL version", renderer.Version)
 
-	scene, err := game.BuildScene(*flagWatch)
+	if *flagPalette != "" {
+		palette, err := tex.LoadPalette(*flagPalette)
+		if err != nil {
+			panic(err)
+		}
+		dither, ok := tex.DitherNames[*flagDither]
+		if !ok {
+			panic(fmt.Errorf("unknown dither %v", *flagDither))
+		}
+		tex.DefaultQuantizer = &tex.Quantizer{
+			Palette: palette,
+			Dither: dither,
+			Report: func(filename string, report tex.QuantizeReport) {
+				fmt.Printf("%v: %v\n", filename, report)
+			},
+		}
+	}
+
+	var watcher *watch.Watcher
+	if *flagWatch {
+		watcher, err = watch.New(watch.DefaultDelay)
+		if err != nil {
+			panic(err)
+		}
+		defer watcher.Close()
+	}
+
+	if watcher != nil {
+		err := renderer.Shader.Watch(watcher)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	scene, err := game.BuildScene(watcher, *flagStrict, *flagAtlas)
 	if err != nil {
 		panic(err)
 	}
@@ -53,8 +96,31 @@ func main() {
 	game.InitInput(renderer.Window)
 
 	for renderer.Run() {
-		tex.ProcessUpdates()
-		obj.ProcessUpdates(nil)
+		tex.ProcessUpdates(reloadBudget, func(update *tex.TextureUpdate) {
+			fmt.Printf("reloaded %v (%vx%v)\n", update.Texture.Filename, update.Size.X, update.Size.Y)
+		})
+		gfx.ProcessUpdates(reloadBudget, func(update *gfx.ShaderUpdate) {
+			if update.Err != nil {
+				fmt.Printf("could not reload shader, keeping the old version: %v\n", update.Err)
+				return
+			}
+			fmt.Printf("reloaded %v and %v\n", update.Shader.Vertex, update.Shader.Fragment)
+		})
+		obj.ProcessUpdates(reloadBudget, func(update *obj.ObjectUpdate) {
+			if update.Err != nil {
+				fmt.Printf("could not reload %v, keeping the old version: %v\n", update.Object.Filename, update.Err)
+				return
+			}
+			fmt.Printf("reloaded %v (%v tris, %v warnings)\n", update.Object.Filename, len(update.Object.Indices) / 3, len(update.Warnings))
+			game.PrintWarnings(update.Warnings)
+			err := scene.ReloadTextures(update.Object)
+			if err != nil {
+				fmt.Println(err)
+			}
+			if update.Object == scene.Level.Geometry {
+				scene.Level.BuildLOD(game.LevelDetail)
+			}
+		})
 
 		renderer.Render(func() {
 			scene.Render()
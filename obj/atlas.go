@@ -0,0 +1,76 @@
+package obj
+
+import (
+	"fmt"
+	tex "github.com/crabmusket/lowrezjam2017/tex"
+)
+
+// Draw the object from an atlas instead of separate textures. Each vertex is
+// given the AtlasRect of its material's texture, which the shader wraps
+// texture coordinates into so that tiling still works. Vertices shared by
+// materials with different textures are split so each can have its own rect.
+// Objects which are already bound have to be bound again afterwards.
+func (self *Object) UseAtlas(atlas *tex.Atlas) error {
+	rects := make([][4]float32, len(self.Materials))
+	for i, material := range(self.Materials) {
+		rect, ok := atlas.Entries[material.TextureName()]
+		if !ok {
+			return fmt.Errorf("material %v uses %v, which isn't in the atlas", material.Name, material.TextureName())
+		}
+		rects[i] = [4]float32{rect.X, rect.Y, rect.Width, rect.Height}
+	}
+
+	format := self.Format
+	if !format.Has(AtlasRect) {
+		format = append(append(VertexFormat{}, format...), AtlasRect)
+	}
+	vertices := self.Format.convert(self.Vertices, format)
+	stride := format.Stride()
+	offset := format.Offset(AtlasRect)
+	numVerts := len(vertices) / stride
+
+	assigned := make([]int, numVerts)
+	for i := range(assigned) {
+		assigned[i] = -1
+	}
+	// Copies of vertices made for a material, by original vertex and material
+	type copied struct{
+		vert uint32
+		material int
+	}
+	copies := make(map[copied]uint32)
+
+	indices := make([]uint32, len(self.Indices))
+	copy(indices, self.Indices)
+	for m, material := range(self.Materials) {
+		for i := material.Start; i < material.End; i += 1 {
+			vert := indices[i]
+			if assigned[vert] < 0 {
+				assigned[vert] = m
+				copy(vertices[int(vert)*stride+offset:], rects[m][:])
+				continue
+			}
+			if assigned[vert] == m || rects[assigned[vert]] == rects[m] {
+				continue
+			}
+
+			key := copied{vert, m}
+			split, ok := copies[key]
+			if !ok {
+				split = uint32(len(vertices) / stride)
+				copies[key] = split
+				vertices = append(vertices, vertices[int(vert)*stride:int(vert+1)*stride]...)
+				copy(vertices[int(split)*stride+offset:], rects[m][:])
+			}
+			indices[i] = split
+		}
+	}
+
+	self.Format = format
+	self.Vertices = vertices
+	self.Indices = indices
+	self.Atlas = atlas
+	self.Stats.Vertices = len(vertices) / stride
+
+	return nil
+}
@@ -0,0 +1,524 @@
+package obj
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	mgl "github.com/go-gl/mathgl/mgl32"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Baked meshes are a straight dump of an Object's buffers so they can be
+// loaded without parsing any text. All values are little-endian.
+//
+//	magic    [4]byte "LRZM"
+//	version  uint32
+//	source   [32]byte sourceHash of the files the mesh was baked from
+//	files    uint32 count, then each file's name, size and modification time
+//	format   uint32 count, then one byte per Attribute
+//	vertices uint32 count, then that many float32
+//	indices  uint32 count, then that many uint32
+//	bounds   Bounds of the whole mesh, as float32s
+//	libraries, materials, parts and stats as written by Bake
+//
+// Strings are a uint32 length followed by that many bytes.
+const (
+	bakedMagic = "LRZM"
+	bakedVersion uint32 = 4
+)
+
+type SourceHash [sha256.Size]byte
+
+// What a mesh was baked from.
+type BakedSource struct{
+	Hash SourceHash
+	// The mesh file first, then the files it depends on.
+	Files []SourceFile
+}
+
+type SourceFile struct{
+	// Relative to the mesh file's directory, with forward slashes.
+	Name string
+	// -1 if the file was missing.
+	Size int64
+	ModTime int64
+}
+
+// Load a mesh from a baked cache file, as long as it was baked from the files
+// the mesh is made from as they are now, and passes Validate. If it wasn't, the
+// mesh is read as normal and the cache is rewritten. Meshes loaded from the
+// cache have no warnings, since nothing was parsed. Meshes with errors in them
+// are never cached, so strict mode can't be skipped.
+func LoadBaked(filename string, bakedFilename string, options Options) (*Object, []*Warning, error) {
+	obj, warnings, err := readOrBake(filename, bakedFilename, options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	obj.Bind()
+
+	return obj, warnings, nil
+}
+
+func readOrBake(filename string, bakedFilename string, options Options) (*Object, []*Warning, error) {
+	var warnings []*Warning
+	obj, err := readBakedIfFresh(filename, bakedFilename)
+	if err == nil {
+		err = obj.Validate()
+		if err == nil {
+			options.apply(obj)
+			return obj, nil, nil
+		}
+		warnings = append(warnings, &Warning{
+			Filename: bakedFilename,
+			Severity: SeverityInfo,
+			Code: BadStructure,
+			Warning: "baked mesh is invalid, so it was baked again: " + err.Error(),
+		})
+	}
+
+	// The mesh is looked at before it's read, so a change made while it's
+	// being read leaves the cache looking stale rather than fresh.
+	stamp := stampFile(filepath.Dir(filename), filepath.Base(filename))
+	source, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	obj, readWarnings, err := readFile(filename, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	warnings = append(warnings, readWarnings...)
+
+	if len(errorsIn(warnings)) == 0 {
+		dependencies := sourceDependencies(filename, source, obj)
+		baked := BakedSource{Files: []SourceFile{stamp}}
+		for _, dependency := range(dependencies) {
+			baked.Files = append(baked.Files, stampFile(filepath.Dir(filename), dependency))
+		}
+		baked.Hash = sourceHash(filename, source, dependencies)
+
+		err = writeBaked(bakedFilename, obj, baked)
+		if err != nil {
+			warnings = append(warnings, &Warning{
+				Filename: bakedFilename,
+				Severity: SeverityWarning,
+				Code: WriteFailed,
+				Warning: "could not write baked mesh: " + err.Error(),
+			})
+		}
+	}
+
+	return obj, warnings, nil
+}
+
+// Read a baked mesh if the files it was baked from haven't changed. Files
+// with the same size and modification time as when it was baked are trusted
+// without being read. Otherwise their contents are hashed, and if they turn out
+// to be the same after all the cache is given the new times so the next load
+// doesn't have to hash them again.
+func readBakedIfFresh(filename string, bakedFilename string) (*Object, error) {
+	file, err := os.Open(bakedFilename)
+	if err != nil {
+		return nil, err
+	}
+	obj, baked, err := ReadBaked(bufio.NewReader(file))
+	file.Close()
+	if err != nil {
+		return nil, err
+	}
+	if len(baked.Files) == 0 || baked.Files[0].Name != filepath.Base(filename) {
+		return nil, fmt.Errorf("%v was baked from a different file", bakedFilename)
+	}
+
+	dir := filepath.Dir(filename)
+	current := make([]SourceFile, len(baked.Files))
+	changed := false
+	for i, stamp := range(baked.Files) {
+		current[i] = stampFile(dir, stamp.Name)
+		changed = changed || current[i] != stamp
+	}
+
+	if changed {
+		source, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		var dependencies []string
+		for _, stamp := range(baked.Files[1:]) {
+			dependencies = append(dependencies, stamp.Name)
+		}
+		if sourceHash(filename, source, dependencies) != baked.Hash {
+			return nil, fmt.Errorf("%v was baked from a different source", bakedFilename)
+		}
+
+		// Only the times are out of date. If they can't be updated, the next
+		// load will just hash the files again.
+		baked.Files = current
+		writeBaked(bakedFilename, obj, baked)
+	}
+
+	obj.Filename = filename
+	return obj, nil
+}
+
+// The size and modification time of a file, named relative to dir.
+func stampFile(dir string, name string) SourceFile {
+	stamp := SourceFile{Name: filepath.ToSlash(name), Size: -1}
+	info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+	if err == nil {
+		stamp.Size = info.Size()
+		stamp.ModTime = info.ModTime().UnixNano()
+	}
+	return stamp
+}
+
+// A hash of a mesh file and every file it depends on, named relative to the
+// mesh's directory, so a cache is rebuilt when any of them changes even if
+// its size and time don't.
+func sourceHash(filename string, source []byte, dependencies []string) SourceHash {
+	dir := filepath.Dir(filename)
+	hash := sha256.New()
+	hash.Write(source)
+	for _, dependency := range(dependencies) {
+		// Each file is named so that moving data between them is a change.
+		fmt.Fprintf(hash, "\x00%v\x00", filepath.ToSlash(dependency))
+		data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(dependency)))
+		if err != nil {
+			hash.Write([]byte("missing"))
+			continue
+		}
+		hash.Write(data)
+	}
+
+	var sum SourceHash
+	copy(sum[:], hash.Sum(nil))
+	return sum
+}
+
+// The files a mesh depends on, relative to its directory: the material
+// libraries of an obj file, or the external buffers of a glTF file. These are
+// only found when a mesh is baked, so the glTF is read a second time, but an
+// obj already knows its libraries.
+func sourceDependencies(filename string, source []byte, obj *Object) []string {
+	var dependencies []string
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".gltf", ".glb":
+		data := source
+		if len(data) >= 4 && binary.LittleEndian.Uint32(data) == glbMagic {
+			var err error
+			data, _, err = splitGLB(data)
+			if err != nil {
+				return nil
+			}
+		}
+		document := new(gltfDocument)
+		if json.Unmarshal(data, document) != nil {
+			return nil
+		}
+		for _, buffer := range(document.Buffers) {
+			if buffer.URI == "" || strings.HasPrefix(buffer.URI, "data:") {
+				continue
+			}
+			name, err := url.PathUnescape(buffer.URI)
+			if err == nil {
+				dependencies = append(dependencies, name)
+			}
+		}
+
+	default:
+		dependencies = append(dependencies, obj.MaterialLibraries...)
+	}
+
+	return dependencies
+}
+
+// Write to a temporary file first so a crash never leaves a half-written cache.
+func writeBaked(bakedFilename string, obj *Object, source BakedSource) error {
+	var buffer bytes.Buffer
+	err := Bake(&buffer, obj, source)
+	if err != nil {
+		return err
+	}
+
+	temp := bakedFilename + ".tmp"
+	err = ioutil.WriteFile(temp, buffer.Bytes(), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(temp, bakedFilename)
+}
+
+func Bake(writer io.Writer, obj *Object, source BakedSource) error {
+	w := &bakedWriter{writer: writer}
+
+	w.bytes([]byte(bakedMagic))
+	w.value(bakedVersion)
+	w.bytes(source.Hash[:])
+	w.value(uint32(len(source.Files)))
+	for _, file := range(source.Files) {
+		w.string(file.Name)
+		w.value(file.Size)
+		w.value(file.ModTime)
+	}
+	w.value(uint32(len(obj.Format)))
+	for _, attribute := range(obj.Format) {
+		w.value(uint8(attribute))
+	}
+	w.value(uint32(len(obj.Vertices)))
+	w.value(obj.Vertices)
+	w.value(uint32(len(obj.Indices)))
+	w.value(obj.Indices)
+	w.value(obj.Bounds)
+
+	w.value(uint32(len(obj.MaterialLibraries)))
+	for _, library := range(obj.MaterialLibraries) {
+		w.string(library)
+	}
+
+	w.value(uint32(len(obj.Materials)))
+	for _, material := range(obj.Materials) {
+		w.material(material)
+		w.description(material.Description)
+	}
+
+	w.value(uint32(len(obj.Parts)))
+	for _, part := range(obj.Parts) {
+		w.string(part.Object)
+		w.string(part.Group)
+		w.value(part.Start)
+		w.value(part.End)
+		w.value(part.Bounds)
+		w.value(uint32(len(part.Materials)))
+		for _, material := range(part.Materials) {
+			w.material(material)
+		}
+	}
+
+	w.value(uint32(obj.Stats.Corners))
+	w.value(uint32(obj.Stats.Vertices))
+
+	return w.err
+}
+
+func ReadBaked(reader io.Reader) (*Object, BakedSource, error) {
+	r := &bakedReader{reader: reader}
+	obj := new(Object)
+	var source BakedSource
+
+	magic := make([]byte, len(bakedMagic))
+	r.bytes(magic)
+	if r.err == nil && string(magic) != bakedMagic {
+		return nil, source, fmt.Errorf("not a baked mesh")
+	}
+
+	version := r.uint32()
+	if r.err == nil && version != bakedVersion {
+		return nil, source, fmt.Errorf("baked mesh version %v is not supported", version)
+	}
+
+	r.bytes(source.Hash[:])
+	source.Files = make([]SourceFile, r.count(20))
+	for i := range(source.Files) {
+		source.Files[i].Name = r.string()
+		r.value(&source.Files[i].Size)
+		r.value(&source.Files[i].ModTime)
+	}
+	obj.Format = make(VertexFormat, r.count(1))
+	for i := range(obj.Format) {
+		var attribute uint8
+		r.value(&attribute)
+		if r.err == nil && int(attribute) >= len(AttributeNames) {
+			return nil, source, fmt.Errorf("baked mesh has unknown attribute %v", attribute)
+		}
+		obj.Format[i] = Attribute(attribute)
+	}
+
+	obj.Vertices = make([]float32, r.count(4))
+	r.value(obj.Vertices)
+	obj.Indices = make([]uint32, r.count(4))
+	r.value(obj.Indices)
+	r.value(&obj.Bounds)
+
+	obj.MaterialLibraries = make([]string, r.count(4))
+	for i := range(obj.MaterialLibraries) {
+		obj.MaterialLibraries[i] = r.string()
+	}
+
+	descriptions := make(MaterialLibrary)
+	obj.Materials = make([]Material, r.count(8))
+	for i := range(obj.Materials) {
+		obj.Materials[i] = r.material()
+		obj.Materials[i].Description = r.description()
+		if obj.Materials[i].Description != nil {
+			descriptions[obj.Materials[i].Name] = obj.Materials[i].Description
+		}
+	}
+
+	obj.Parts = make([]*Part, r.count(16))
+	for i := range(obj.Parts) {
+		part := &Part{
+			Object: r.string(),
+			Group: r.string(),
+			Start: r.uint32(),
+			End: r.uint32(),
+		}
+		r.value(&part.Bounds)
+		part.Transform = mgl.Ident4()
+
+		part.Materials = make([]Material, r.count(8))
+		for j := range(part.Materials) {
+			part.Materials[j] = r.material()
+			part.Materials[j].Description = descriptions[part.Materials[j].Name]
+		}
+		obj.Parts[i] = part
+	}
+
+	obj.Stats.Corners = int(r.uint32())
+	obj.Stats.Vertices = int(r.uint32())
+
+	if r.err != nil {
+		return nil, source, r.err
+	}
+
+	return obj, source, nil
+}
+
+type bakedWriter struct{
+	writer io.Writer
+	err error
+}
+
+func (self *bakedWriter) bytes(data []byte) {
+	if self.err != nil {
+		return
+	}
+	_, self.err = self.writer.Write(data)
+}
+
+func (self *bakedWriter) value(data interface{}) {
+	if self.err != nil {
+		return
+	}
+	self.err = binary.Write(self.writer, binary.LittleEndian, data)
+}
+
+func (self *bakedWriter) string(s string) {
+	self.value(uint32(len(s)))
+	self.bytes([]byte(s))
+}
+
+func (self *bakedWriter) material(material Material) {
+	self.string(material.Name)
+	self.value(material.Start)
+	self.value(material.End)
+	self.value(material.Bounds)
+}
+
+func (self *bakedWriter) description(description *MaterialDescription) {
+	if description == nil {
+		self.value(uint8(0))
+		return
+	}
+
+	self.value(uint8(1))
+	self.string(description.Name)
+	self.value(description.Ambient)
+	self.value(description.Diffuse)
+	self.value(description.Specular)
+	self.value(description.Shininess)
+	self.value(description.Dissolve)
+	self.value(int32(description.Illumination))
+	self.string(description.DiffuseMap)
+	self.string(description.BumpMap)
+}
+
+type bakedReader struct{
+	reader io.Reader
+	err error
+}
+
+func (self *bakedReader) bytes(data []byte) {
+	if self.err != nil {
+		return
+	}
+	_, self.err = io.ReadFull(self.reader, data)
+}
+
+func (self *bakedReader) value(data interface{}) {
+	if self.err != nil {
+		return
+	}
+	self.err = binary.Read(self.reader, binary.LittleEndian, data)
+}
+
+func (self *bakedReader) uint32() uint32 {
+	var v uint32
+	self.value(&v)
+	return v
+}
+
+// Read an element count, refusing anything too big to be real so a corrupt
+// file can't make us allocate gigabytes. size is the smallest possible size of
+// one element in bytes.
+func (self *bakedReader) count(size int) int {
+	const maxBytes = 1 << 30
+	count := self.uint32()
+	if self.err == nil && uint64(count) * uint64(size) > maxBytes {
+		self.err = fmt.Errorf("baked mesh is corrupt: count %v is too large", count)
+	}
+	if self.err != nil {
+		return 0
+	}
+	return int(count)
+}
+
+func (self *bakedReader) string() string {
+	data := make([]byte, self.count(1))
+	self.bytes(data)
+	return string(data)
+}
+
+func (self *bakedReader) material() Material {
+	material := Material{
+		Name: self.string(),
+		Start: self.uint32(),
+		End: self.uint32(),
+	}
+	self.value(&material.Bounds)
+	return material
+}
+
+func (self *bakedReader) description() *MaterialDescription {
+	var present uint8
+	self.value(&present)
+	if present == 0 {
+		return nil
+	}
+
+	description := &MaterialDescription{
+		Name: self.string(),
+	}
+	self.value(&description.Ambient)
+	self.value(&description.Diffuse)
+	self.value(&description.Specular)
+	self.value(&description.Shininess)
+	self.value(&description.Dissolve)
+	var illumination int32
+	self.value(&illumination)
+	description.Illumination = int(illumination)
+	description.DiffuseMap = self.string()
+	description.BumpMap = self.string()
+
+	return description
+}
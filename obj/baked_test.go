@@ -0,0 +1,257 @@
+package obj
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBakeRoundTrip(t *testing.T) {
+	sources := make(map[string]string)
+	for name, source := range(roundTripSources) {
+		sources[name] = source
+	}
+	level, err := ioutil.ReadFile("../resources/meshes/floor1.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources["floor1.obj"] = string(level)
+
+	for name, source := range(sources) {
+		original, _, err := Read(strings.NewReader(source))
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		source := BakedSource{
+			Hash: SourceHash{1, 2, 3},
+			Files: []SourceFile{{"mesh.obj", 1234, 5678}, {"textures/mesh.mtl", -1, 0}},
+		}
+
+		var buffer bytes.Buffer
+		err = Bake(&buffer, original, source)
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		baked, bakedSource, err := ReadBaked(&buffer)
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+
+		if !reflect.DeepEqual(bakedSource, source) {
+			t.Errorf("%v: source %v became %v", name, source, bakedSource)
+		}
+		if !formatsEqual(original.Format, baked.Format) {
+			t.Errorf("%v: format %v became %v", name, original.Format, baked.Format)
+		}
+		if !verticesClose(original.Vertices, baked.Vertices) || !indicesEqual(original.Indices, baked.Indices) {
+			t.Errorf("%v: buffers changed", name)
+		}
+		if !materialsEqual(original.Materials, baked.Materials) {
+			t.Errorf("%v: materials %v became %v", name, original.Materials, baked.Materials)
+		}
+		if original.Bounds != baked.Bounds {
+			t.Errorf("%v: bounds %v became %v", name, original.Bounds, baked.Bounds)
+		}
+		if len(original.Parts) != len(baked.Parts) {
+			t.Fatalf("%v: %v parts became %v", name, len(original.Parts), len(baked.Parts))
+		}
+		for i, part := range(original.Parts) {
+			other := baked.Parts[i]
+			if part.Name() != other.Name() || part.Start != other.Start || part.End != other.End || !materialsEqual(part.Materials, other.Materials) {
+				t.Errorf("%v: part %v changed", name, part.Name())
+			}
+		}
+		err = baked.Validate()
+		if err != nil {
+			t.Errorf("%v: %v", name, err)
+		}
+	}
+}
+
+func TestReadBakedErrors(t *testing.T) {
+	original, _, err := Read(strings.NewReader(roundTripSources["single triangle"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buffer bytes.Buffer
+	err = Bake(&buffer, original, BakedSource{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	good := buffer.Bytes()
+
+	changed := func(offset int, data ...byte) []byte {
+		bad := append([]byte{}, good...)
+		copy(bad[offset:], data)
+		return bad
+	}
+	// With no files, the vertex count comes after the magic, version, hash,
+	// file count and format.
+	files := 4 + 4 + len(SourceHash{})
+	vertexCount := files + 4 + 4 + len(original.Format)
+
+	tests := []struct{
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"bad magic", changed(0, 'N', 'O', 'P', 'E')},
+		{"bad version", changed(4, 99)},
+		{"huge file count", changed(files, 0xff, 0xff, 0xff, 0xff)},
+		{"unknown attribute", changed(files + 4 + 4, 200)},
+		{"huge count", changed(vertexCount, 0xff, 0xff, 0xff, 0xff)},
+		{"truncated", good[:len(good) - 1]},
+	}
+
+	for _, test := range(tests) {
+		_, _, err := ReadBaked(bytes.NewReader(test.data))
+		if err == nil {
+			t.Errorf("%v: expected an error", test.name)
+		}
+	}
+}
+
+// Write a mesh and its library into a temporary folder.
+func writeBakeSources(t *testing.T, dir string, library string) (string, string) {
+	filename := filepath.Join(dir, "mesh.obj")
+	source := "mtllib mesh.mtl\n" + roundTripSources["single triangle"] + "usemtl a\nf 1/1/1 3/3/1 2/2/1\n"
+	err := ioutil.WriteFile(filename, []byte(source), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "mesh.mtl"), []byte(library), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filename, filepath.Join(dir, "mesh.obj.baked")
+}
+
+// Put every file in dir back to the same time.
+func resetTimes(t *testing.T, dir string, then time.Time) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range(files) {
+		err := os.Chtimes(filepath.Join(dir, file.Name()), then, then)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// What the cache at bakedFilename says it was baked from, and where its
+// buffers start.
+func bakedHeader(t *testing.T, bakedFilename string) (BakedSource, int) {
+	data, err := ioutil.ReadFile(bakedFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, source, err := ReadBaked(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := 4 + 4 + len(SourceHash{}) + 4
+	for _, file := range(source.Files) {
+		size += 4 + len(file.Name) + 8 + 8
+	}
+	return source, size
+}
+
+func TestReadOrBake(t *testing.T) {
+	dir, err := ioutil.TempDir("", "baked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename, bakedFilename := writeBakeSources(t, dir, "newmtl a\nKd 1 0 0\n")
+	first, _, err := readOrBake(filename, bakedFilename, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, _ := bakedHeader(t, bakedFilename)
+	if len(source.Files) != 2 || source.Files[0].Name != "mesh.obj" || source.Files[1].Name != "mesh.mtl" {
+		t.Fatalf("cache should list the mesh and its library, got %v", source.Files)
+	}
+
+	cached, warnings, err := readOrBake(filename, bakedFilename, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 || !indicesEqual(first.Indices, cached.Indices) {
+		t.Errorf("expected the mesh to come from the cache, got %v warnings", len(warnings))
+	}
+
+	// Files which were touched but not changed are hashed, and the cache
+	// learns their new times.
+	then := time.Unix(1500000000, 0)
+	resetTimes(t, dir, then)
+	touched, warnings, err := readOrBake(filename, bakedFilename, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 || !indicesEqual(first.Indices, touched.Indices) {
+		t.Errorf("expected a touched mesh to come from the cache, got %v warnings", len(warnings))
+	}
+	source, _ = bakedHeader(t, bakedFilename)
+	for _, file := range(source.Files) {
+		if file.ModTime != then.UnixNano() {
+			t.Errorf("%v: cache still has the old time", file.Name)
+		}
+	}
+
+	// A library is noticed to have changed if either its size or its time
+	// did.
+	tests := []struct{
+		name string
+		library string
+		then time.Time
+		diffuse [3]float32
+	}{
+		{"same size", "newmtl a\nKd 0 1 0\n", then.Add(time.Second), [3]float32{0, 1, 0}},
+		{"same time", "newmtl a\nKd 0 0 0.5\n", then.Add(time.Second), [3]float32{0, 0, 0.5}},
+	}
+	for _, test := range(tests) {
+		writeBakeSources(t, dir, test.library)
+		resetTimes(t, dir, test.then)
+		changed, _, err := readOrBake(filename, bakedFilename, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diffuse := changed.Materials[0].Description.Diffuse; diffuse != test.diffuse {
+			t.Errorf("%v: library change was missed, diffuse is %v", test.name, diffuse)
+		}
+	}
+
+	// A cache with the right source but an index past the end of the
+	// vertices is baked again.
+	data, err := ioutil.ReadFile(bakedFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, header := bakedHeader(t, bakedFilename)
+	indices := header + 4 + len(first.Format) + 4 + 4 * len(first.Vertices) + 4
+	binary.LittleEndian.PutUint32(data[indices:], 1000)
+	err = ioutil.WriteFile(bakedFilename, data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rebaked, warnings, err := readOrBake(filename, bakedFilename, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) == 0 || warnings[0].Code != BadStructure {
+		t.Errorf("expected a warning about the invalid cache, got %v", warnings)
+	}
+	err = rebaked.Validate()
+	if err != nil {
+		t.Error(err)
+	}
+}
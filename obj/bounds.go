@@ -0,0 +1,136 @@
+package obj
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl32"
+	"math"
+)
+
+// An axis-aligned bounding box, and a bounding sphere around the same
+// vertices. Empty ranges of indices have zero bounds.
+type Bounds struct{
+	Min mgl.Vec3
+	Max mgl.Vec3
+	Center mgl.Vec3
+	Radius float32
+}
+
+func (self Bounds) Contains(point mgl.Vec3) bool {
+	for i := 0; i < 3; i += 1 {
+		if point[i] < self.Min[i] || point[i] > self.Max[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (self Bounds) Size() mgl.Vec3 {
+	return self.Max.Sub(self.Min)
+}
+
+// Whether two boxes overlap, for broad-phase collision.
+func (self Bounds) Intersects(other Bounds) bool {
+	for i := 0; i < 3; i += 1 {
+		if self.Max[i] < other.Min[i] || other.Max[i] < self.Min[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Bounds in the space a model matrix moves them to. The box is grown to fit
+// all its transformed corners, and the sphere is scaled by the largest axis
+// scale, so both still contain everything they did before.
+func (self Bounds) Transform(model mgl.Mat4) Bounds {
+	inf := float32(math.Inf(1))
+	bounds := Bounds{
+		Min: mgl.Vec3{inf, inf, inf},
+		Max: mgl.Vec3{-inf, -inf, -inf},
+	}
+
+	for corner := 0; corner < 8; corner += 1 {
+		point := self.Min
+		for i := 0; i < 3; i += 1 {
+			if corner & (1 << uint(i)) != 0 {
+				point[i] = self.Max[i]
+			}
+		}
+		bounds.grow(mgl.TransformCoordinate(point, model))
+	}
+
+	scale := float32(0)
+	for i := 0; i < 3; i += 1 {
+		axis := model.Col(i).Vec3().Len()
+		if axis > scale {
+			scale = axis
+		}
+	}
+	bounds.Center = mgl.TransformCoordinate(self.Center, model)
+	bounds.Radius = self.Radius * scale
+
+	return bounds
+}
+
+func (self *Bounds) grow(point mgl.Vec3) {
+	for i := 0; i < 3; i += 1 {
+		if point[i] < self.Min[i] {
+			self.Min[i] = point[i]
+		}
+		if point[i] > self.Max[i] {
+			self.Max[i] = point[i]
+		}
+	}
+}
+
+// Find the bounds of the vertices referenced by a range of indices. The sphere
+// is centred on the box, which isn't the smallest possible sphere but is
+// close for the kinds of shapes levels are made of.
+func computeBounds(vertices []float32, format VertexFormat, indices []uint32) Bounds {
+	if len(indices) == 0 {
+		return Bounds{}
+	}
+
+	stride := format.Stride()
+	offset := format.Offset(Position)
+	position := func(index uint32) mgl.Vec3 {
+		v := vertices[int(index)*stride+offset:]
+		return mgl.Vec3{v[0], v[1], v[2]}
+	}
+
+	inf := float32(math.Inf(1))
+	bounds := Bounds{
+		Min: mgl.Vec3{inf, inf, inf},
+		Max: mgl.Vec3{-inf, -inf, -inf},
+	}
+
+	for _, index := range(indices) {
+		bounds.grow(position(index))
+	}
+
+	bounds.Center = bounds.Min.Add(bounds.Max).Mul(0.5)
+	for _, index := range(indices) {
+		distance := position(index).Sub(bounds.Center).Len()
+		if distance > bounds.Radius {
+			bounds.Radius = distance
+		}
+	}
+
+	return bounds
+}
+
+// Compute the bounds of the whole object, each of its materials and each of
+// its parts. This has to be done again whenever the vertices change.
+func (self *Object) updateBounds() {
+	self.Bounds = computeBounds(self.Vertices, self.Format, self.Indices)
+	self.updateMaterialBounds(self.Materials)
+	for _, part := range(self.Parts) {
+		part.Bounds = computeBounds(self.Vertices, self.Format, self.Indices[part.Start:part.End])
+		self.updateMaterialBounds(part.Materials)
+	}
+}
+
+func (self *Object) updateMaterialBounds(materials []Material) {
+	for i := range(materials) {
+		material := &materials[i]
+		material.Bounds = computeBounds(self.Vertices, self.Format, self.Indices[material.Start:material.End])
+	}
+}
@@ -0,0 +1,82 @@
+package obj
+
+// Vertex attributes, numbered by the location they're bound to in shaders.
+type Attribute int
+
+const (
+	Position Attribute = iota
+	Normal
+	TextureCoords
+	Tangent
+	Colour
+	// The rectangle of an atlas a vertex's texture coordinates are wrapped
+	// into, as x y width height.
+	AtlasRect
+)
+
+// Shader input names for each attribute, indexed by location. Pass these to
+// graphics.MakeProgram so shaders agree with Object.Bind.
+var AttributeNames = []string{"pos", "norm", "tex", "tangent", "colour", "atlasRect"}
+
+var attributeSizes = []int{3, 3, 2, 4, 3, 4}
+
+func (self Attribute) Size() int {
+	return attributeSizes[self]
+}
+
+func (self Attribute) String() string {
+	return AttributeNames[self]
+}
+
+// The attributes interleaved in each vertex, in order.
+type VertexFormat []Attribute
+
+var DefaultFormat = VertexFormat{Position, Normal, TextureCoords}
+
+// Number of floats per vertex.
+func (self VertexFormat) Stride() int {
+	stride := 0
+	for _, attribute := range(self) {
+		stride += attribute.Size()
+	}
+	return stride
+}
+
+// Offset of an attribute from the start of a vertex in floats, or -1 if the
+// format doesn't have it.
+func (self VertexFormat) Offset(attribute Attribute) int {
+	offset := 0
+	for _, a := range(self) {
+		if a == attribute {
+			return offset
+		}
+		offset += a.Size()
+	}
+	return -1
+}
+
+func (self VertexFormat) Has(attribute Attribute) bool {
+	return self.Offset(attribute) >= 0
+}
+
+// Copy vertices into a new format. Attributes the old format doesn't have are
+// left as zeroes for the caller to fill in.
+func (self VertexFormat) convert(vertices []float32, format VertexFormat) []float32 {
+	numVerts := len(vertices) / self.Stride()
+	stride := format.Stride()
+	converted := make([]float32, numVerts * stride)
+
+	for _, attribute := range(format) {
+		from := self.Offset(attribute)
+		if from < 0 {
+			continue
+		}
+		to := format.Offset(attribute)
+		size := attribute.Size()
+		for vert := 0; vert < numVerts; vert += 1 {
+			copy(converted[vert*stride+to:vert*stride+to+size], vertices[vert*self.Stride()+from:])
+		}
+	}
+
+	return converted
+}
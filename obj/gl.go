@@ -19,17 +19,14 @@ func (self *Object) Bind() {
 	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, ebo)
 	gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, 4 * len(self.Indices), gl.Ptr(self.Indices), gl.STATIC_DRAW)
 
-	// positions
-	gl.VertexAttribPointer(0, 3, gl.FLOAT, false, 8*4, nil)
-	gl.EnableVertexAttribArray(0)
-
-	// normals
-	gl.VertexAttribPointer(1, 3, gl.FLOAT, false, 8*4, gl.PtrOffset(3*4))
-	gl.EnableVertexAttribArray(1)
-
-	// tex coords
-	gl.VertexAttribPointer(2, 2, gl.FLOAT, false, 8*4, gl.PtrOffset(6*4))
-	gl.EnableVertexAttribArray(2)
+	// Each attribute is bound to the location matching its number, see
+	// AttributeNames.
+	stride := self.Format.Stride()
+	for _, attribute := range(self.Format) {
+		offset := self.Format.Offset(attribute)
+		gl.VertexAttribPointer(uint32(attribute), int32(attribute.Size()), gl.FLOAT, false, int32(stride*4), gl.PtrOffset(offset*4))
+		gl.EnableVertexAttribArray(uint32(attribute))
+	}
 
 	gl.BindVertexArray(0)
 
@@ -44,20 +41,89 @@ func (self *Object) Unbind() {
 	gl.DeleteBuffers(1, &self.Ebo)
 }
 
-func (self Object) Render(textures tex.Library) {
+func (self Object) Render(textures *tex.Library) {
+	self.RenderEach(textures, nil)
+}
+
+// Render every visible part, calling setup before each one is drawn so the
+// caller can apply the part's transform. Materials whose texture isn't in
+// textures are drawn with its placeholder. Diffuse textures are bound to
+// texture unit 0 and normal maps to unit 1, or a flat one for materials
+// without a normal map.
+func (self Object) RenderEach(textures *tex.Library, setup func(part *Part)) {
 	gl.BindVertexArray(self.Id)
 
-	for _, material := range(self.Materials) {
-		texture := textures[material.Name]
-		if texture == nil {
+	// Meshes without vertex colours are drawn as if they were white
+	if !self.Format.Has(Colour) {
+		gl.VertexAttrib3f(uint32(Colour), 1, 1, 1)
+	}
+	// and without an atlas, each texture covers the whole of texture space.
+	if !self.Format.Has(AtlasRect) {
+		gl.VertexAttrib4f(uint32(AtlasRect), 0, 0, 1, 1)
+	}
+	// Without tangents there's nothing to normal map with, but the flat normal
+	// map doesn't need them.
+	if !self.Format.Has(Tangent) {
+		gl.VertexAttrib4f(uint32(Tangent), 1, 0, 0, 1)
+	}
+	if self.Atlas != nil {
+		gl.BindTexture(gl.TEXTURE_2D, self.Atlas.Texture.Id)
+		bindNormalMap(textures.FlatNormal())
+	}
+
+	for _, part := range(self.Parts) {
+		if part.Hidden {
 			continue
 		}
-		gl.BindTexture(gl.TEXTURE_2D, texture.Id)
+		if setup != nil {
+			setup(part)
+		}
 
-		span := int32(material.End - material.Start)
-		begin := gl.PtrOffset(4 * int(material.Start))
-		gl.DrawElements(gl.TRIANGLES, span, gl.UNSIGNED_INT, begin)
+		if self.Atlas != nil {
+			drawAtlasPart(part)
+			continue
+		}
+
+		for _, material := range(part.Materials) {
+			texture := textures.Get(material.TextureName())
+			gl.BindTexture(gl.TEXTURE_2D, texture.Id)
+			if name := material.NormalMapName(); name != "" {
+				bindNormalMap(textures.Get(name))
+			} else {
+				bindNormalMap(textures.FlatNormal())
+			}
+
+			span := int32(material.End - material.Start)
+			begin := gl.PtrOffset(4 * int(material.Start))
+			gl.DrawElements(gl.TRIANGLES, span, gl.UNSIGNED_INT, begin)
+		}
 	}
 
 	gl.BindVertexArray(0)
 }
+
+func bindNormalMap(texture *tex.Texture) {
+	gl.ActiveTexture(gl.TEXTURE1)
+	gl.BindTexture(gl.TEXTURE_2D, texture.Id)
+	gl.ActiveTexture(gl.TEXTURE0)
+}
+
+// Everything comes from the same texture, so materials which follow on from
+// each other can be drawn together.
+func drawAtlasPart(part *Part) {
+	draw := func(start uint32, end uint32) {
+		if end > start {
+			gl.DrawElements(gl.TRIANGLES, int32(end - start), gl.UNSIGNED_INT, gl.PtrOffset(4 * int(start)))
+		}
+	}
+
+	var start, end uint32
+	for _, material := range(part.Materials) {
+		if material.Start != end {
+			draw(start, end)
+			start = material.Start
+		}
+		end = material.End
+	}
+	draw(start, end)
+}
@@ -0,0 +1,774 @@
+package obj
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	mgl "github.com/go-gl/mathgl/mgl32"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// glTF 2.0 meshes are imported through ObjData, so they end up exactly like
+// obj meshes: node transforms are baked into the vertices, every node with a
+// mesh becomes a part, and primitives are grouped into material ranges by
+// material name.
+const (
+	glbMagic uint32 = 0x46546C67
+	glbChunkJSON uint32 = 0x4E4F534A
+	glbChunkBIN uint32 = 0x004E4942
+
+	gltfByte = 5120
+	gltfUnsignedByte = 5121
+	gltfShort = 5122
+	gltfUnsignedShort = 5123
+	gltfUnsignedInt = 5125
+	gltfFloat = 5126
+
+	gltfTriangles = 4
+	gltfTriangleStrip = 5
+	gltfTriangleFan = 6
+
+	gltfDefaultMaterial = "default"
+	gltfMaxElements = 1 << 26
+)
+
+type gltfDocument struct{
+	Scene *int `json:"scene"`
+	Scenes []struct{
+		Nodes []int `json:"nodes"`
+	} `json:"scenes"`
+	Nodes []gltfNode `json:"nodes"`
+	Meshes []gltfMesh `json:"meshes"`
+	Materials []gltfMaterial `json:"materials"`
+	Textures []struct{
+		Source *int `json:"source"`
+	} `json:"textures"`
+	Images []struct{
+		URI string `json:"uri"`
+	} `json:"images"`
+	Accessors []gltfAccessor `json:"accessors"`
+	BufferViews []gltfBufferView `json:"bufferViews"`
+	Buffers []gltfBuffer `json:"buffers"`
+}
+
+type gltfNode struct{
+	Name string `json:"name"`
+	Mesh *int `json:"mesh"`
+	Children []int `json:"children"`
+	Matrix []float32 `json:"matrix"`
+	Translation []float32 `json:"translation"`
+	Rotation []float32 `json:"rotation"`
+	Scale []float32 `json:"scale"`
+}
+
+type gltfMesh struct{
+	Name string `json:"name"`
+	Primitives []gltfPrimitive `json:"primitives"`
+}
+
+type gltfPrimitive struct{
+	Attributes map[string]int `json:"attributes"`
+	Indices *int `json:"indices"`
+	Material *int `json:"material"`
+	Mode *int `json:"mode"`
+}
+
+type gltfTextureInfo struct{
+	Index int `json:"index"`
+}
+
+type gltfMaterial struct{
+	Name string `json:"name"`
+	PbrMetallicRoughness struct{
+		BaseColorFactor []float32 `json:"baseColorFactor"`
+		BaseColorTexture *gltfTextureInfo `json:"baseColorTexture"`
+	} `json:"pbrMetallicRoughness"`
+	NormalTexture *gltfTextureInfo `json:"normalTexture"`
+}
+
+type gltfAccessor struct{
+	BufferView *int `json:"bufferView"`
+	ByteOffset int `json:"byteOffset"`
+	ComponentType int `json:"componentType"`
+	Normalized bool `json:"normalized"`
+	Count int `json:"count"`
+	Type string `json:"type"`
+	Sparse json.RawMessage `json:"sparse"`
+}
+
+type gltfBufferView struct{
+	Buffer int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	ByteStride int `json:"byteStride"`
+}
+
+type gltfBuffer struct{
+	URI string `json:"uri"`
+	ByteLength int `json:"byteLength"`
+}
+
+type gltfImporter struct{
+	document *gltfDocument
+	buffers [][]byte
+	materialNames []string
+	obj *ObjData
+	warnings []*Warning
+	// Nodes which have been imported, and the ones being imported right now.
+	visited []bool
+	onPath []bool
+}
+
+func readGLTFFile(filename string) (*Object, []*Warning, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	obj, warnings, err := ReadGLTF(file, filepath.Dir(filename))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	obj.Filename = filename
+	for _, warning := range warnings {
+		warning.Filename = filename
+	}
+
+	return obj, warnings, nil
+}
+
+// Read a .gltf or .glb file. External buffers and images are found relative to
+// dir.
+func ReadGLTF(reader io.Reader, dir string) (*Object, []*Warning, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var binChunk []byte
+	if len(data) >= 4 && binary.LittleEndian.Uint32(data) == glbMagic {
+		data, binChunk, err = splitGLB(data)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	document := new(gltfDocument)
+	err = json.Unmarshal(data, document)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	buffers, err := loadGLTFBuffers(document, dir, binChunk)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	importer := &gltfImporter{
+		document: document,
+		buffers: buffers,
+		obj: new(ObjData),
+		visited: make([]bool, len(document.Nodes)),
+		onPath: make([]bool, len(document.Nodes)),
+	}
+	descriptions := importer.materials(dir)
+
+	for _, root := range(importer.roots()) {
+		importer.node(root, mgl.Ident4())
+	}
+
+	object, finishWarnings, err := importer.obj.Finish()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	warnings := append(importer.warnings, finishWarnings...)
+	warnings = append(warnings, object.describeMaterials(descriptions)...)
+
+	return object, warnings, nil
+}
+
+func splitGLB(data []byte) ([]byte, []byte, error) {
+	if len(data) < 12 {
+		return nil, nil, fmt.Errorf("glb header is truncated")
+	}
+	version := binary.LittleEndian.Uint32(data[4:])
+	if version != 2 {
+		return nil, nil, fmt.Errorf("glb version %v is not supported", version)
+	}
+
+	var jsonChunk, binChunk []byte
+	rest := data[12:]
+	for len(rest) >= 8 {
+		length := binary.LittleEndian.Uint32(rest)
+		kind := binary.LittleEndian.Uint32(rest[4:])
+		rest = rest[8:]
+		if uint64(length) > uint64(len(rest)) {
+			return nil, nil, fmt.Errorf("glb chunk is truncated")
+		}
+
+		switch {
+		case kind == glbChunkJSON && jsonChunk == nil:
+			jsonChunk = rest[:length]
+		case kind == glbChunkBIN && binChunk == nil:
+			binChunk = rest[:length]
+		}
+		rest = rest[length:]
+	}
+
+	if jsonChunk == nil {
+		return nil, nil, fmt.Errorf("glb has no json chunk")
+	}
+
+	return jsonChunk, binChunk, nil
+}
+
+func loadGLTFBuffers(document *gltfDocument, dir string, binChunk []byte) ([][]byte, error) {
+	buffers := make([][]byte, len(document.Buffers))
+
+	for i, buffer := range(document.Buffers) {
+		var data []byte
+		var err error
+
+		switch {
+		case buffer.URI == "":
+			if i != 0 || binChunk == nil {
+				return nil, fmt.Errorf("buffer %v has no uri", i)
+			}
+			data = binChunk
+
+		case strings.HasPrefix(buffer.URI, "data:"):
+			comma := strings.Index(buffer.URI, ",")
+			if comma < 0 || !strings.HasSuffix(buffer.URI[:comma], ";base64") {
+				return nil, fmt.Errorf("buffer %v has an unsupported data uri", i)
+			}
+			data, err = base64.StdEncoding.DecodeString(buffer.URI[comma+1:])
+
+		default:
+			var name string
+			name, err = url.PathUnescape(buffer.URI)
+			if err == nil {
+				data, err = ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+		if len(data) < buffer.ByteLength {
+			return nil, fmt.Errorf("buffer %v is shorter than its byteLength", i)
+		}
+		buffers[i] = data
+	}
+
+	return buffers, nil
+}
+
+// Describe each material, and pick a unique name for it since glTF doesn't
+// require materials to be named at all.
+func (self *gltfImporter) materials(dir string) MaterialLibrary {
+	descriptions := MaterialLibrary{
+		gltfDefaultMaterial: &MaterialDescription{
+			Name: gltfDefaultMaterial,
+			Diffuse: [3]float32{1, 1, 1},
+			Dissolve: 1,
+		},
+	}
+
+	for i, material := range(self.document.Materials) {
+		name := material.Name
+		if name == "" || descriptions[name] != nil {
+			name = fmt.Sprintf("%v%v", material.Name, i)
+		}
+		self.materialNames = append(self.materialNames, name)
+
+		description := &MaterialDescription{
+			Name: name,
+			Diffuse: [3]float32{1, 1, 1},
+			Dissolve: 1,
+		}
+		if factor := material.PbrMetallicRoughness.BaseColorFactor; len(factor) == 4 {
+			copy(description.Diffuse[:], factor[:3])
+			description.Dissolve = factor[3]
+		}
+		description.DiffuseMap = self.image(material.PbrMetallicRoughness.BaseColorTexture, dir)
+		description.BumpMap = self.image(material.NormalTexture, dir)
+
+		descriptions[name] = description
+	}
+
+	return descriptions
+}
+
+// Only images stored in their own files can be loaded as textures.
+func (self *gltfImporter) image(info *gltfTextureInfo, dir string) string {
+	if info == nil || info.Index < 0 || info.Index >= len(self.document.Textures) {
+		return ""
+	}
+	source := self.document.Textures[info.Index].Source
+	if source == nil || *source < 0 || *source >= len(self.document.Images) {
+		return ""
+	}
+
+	uri := self.document.Images[*source].URI
+	name, err := url.PathUnescape(uri)
+	if uri == "" || strings.HasPrefix(uri, "data:") || err != nil {
+		self.warn(SeverityWarning, UnsupportedFeature, fmt.Sprintf("image %v is embedded, which is not supported", *source))
+		return ""
+	}
+
+	return filepath.Join(dir, filepath.FromSlash(name))
+}
+
+// The nodes of the default scene, or every node which isn't a child if there
+// are no scenes.
+func (self *gltfImporter) roots() []int {
+	document := self.document
+
+	if len(document.Scenes) > 0 {
+		scene := 0
+		if document.Scene != nil && *document.Scene >= 0 && *document.Scene < len(document.Scenes) {
+			scene = *document.Scene
+		}
+		return document.Scenes[scene].Nodes
+	}
+
+	isChild := make([]bool, len(document.Nodes))
+	for _, node := range(document.Nodes) {
+		for _, child := range(node.Children) {
+			if child >= 0 && child < len(isChild) {
+				isChild[child] = true
+			}
+		}
+	}
+
+	var roots []int
+	for i, child := range(isChild) {
+		if !child {
+			roots = append(roots, i)
+		}
+	}
+	return roots
+}
+
+// Import a node and everything under it. Nodes form a tree, so each one is
+// only imported the first time it's reached; otherwise a file which reused
+// subtrees could make us import exponentially many copies of them.
+func (self *gltfImporter) node(index int, parent mgl.Mat4) {
+	if index < 0 || index >= len(self.document.Nodes) {
+		self.warn(SeverityError, BadIndex, fmt.Sprintf("node index %v out of range", index))
+		return
+	}
+	if self.onPath[index] {
+		self.warn(SeverityError, BadStructure, fmt.Sprintf("node hierarchy has a cycle through node %v", index))
+		return
+	}
+	if self.visited[index] {
+		self.warn(SeverityError, BadStructure, fmt.Sprintf("node %v has more than one parent, so only its first is used", index))
+		return
+	}
+	self.visited[index] = true
+	self.onPath[index] = true
+	defer func() {
+		self.onPath[index] = false
+	}()
+
+	node := self.document.Nodes[index]
+	world := parent.Mul4(nodeMatrix(node))
+
+	if node.Mesh != nil {
+		self.mesh(*node.Mesh, node.Name, world)
+	}
+
+	for _, child := range(node.Children) {
+		self.node(child, world)
+	}
+}
+
+func nodeMatrix(node gltfNode) mgl.Mat4 {
+	if len(node.Matrix) == 16 {
+		var matrix mgl.Mat4
+		copy(matrix[:], node.Matrix)
+		return matrix
+	}
+
+	matrix := mgl.Ident4()
+	if t := node.Translation; len(t) == 3 {
+		matrix = mgl.Translate3D(t[0], t[1], t[2])
+	}
+	if r := node.Rotation; len(r) == 4 {
+		rotation := mgl.Quat{W: r[3], V: mgl.Vec3{r[0], r[1], r[2]}}
+		matrix = matrix.Mul4(rotation.Mat4())
+	}
+	if s := node.Scale; len(s) == 3 {
+		matrix = matrix.Mul4(mgl.Scale3D(s[0], s[1], s[2]))
+	}
+	return matrix
+}
+
+func (self *gltfImporter) mesh(index int, nodeName string, world mgl.Mat4) {
+	if index < 0 || index >= len(self.document.Meshes) {
+		self.warn(SeverityError, BadIndex, fmt.Sprintf("mesh index %v out of range", index))
+		return
+	}
+	mesh := self.document.Meshes[index]
+
+	name := nodeName
+	if name == "" {
+		name = mesh.Name
+	}
+	self.obj.Parts = append(self.obj.Parts, PartData{
+		Object: name,
+		Start: uint32(len(self.obj.FaceVerts)),
+	})
+
+	for i, primitive := range(mesh.Primitives) {
+		err := self.primitive(primitive, world)
+		if err != nil {
+			self.warn(SeverityError, BadStructure, fmt.Sprintf("skipped primitive %v of mesh %v: %v", i, name, err))
+		}
+	}
+}
+
+func (self *gltfImporter) primitive(primitive gltfPrimitive, world mgl.Mat4) error {
+	obj := self.obj
+
+	mode := gltfTriangles
+	if primitive.Mode != nil {
+		mode = *primitive.Mode
+	}
+
+	position, ok := primitive.Attributes["POSITION"]
+	if !ok {
+		return fmt.Errorf("no positions")
+	}
+	positions, err := self.floats(position, 3)
+	if err != nil {
+		return err
+	}
+	count := len(positions) / 3
+
+	var normals, texCoords []float32
+	if normal, ok := primitive.Attributes["NORMAL"]; ok {
+		normals, err = self.floats(normal, 3)
+		if err != nil {
+			return err
+		}
+	}
+	if texCoord, ok := primitive.Attributes["TEXCOORD_0"]; ok {
+		texCoords, err = self.floats(texCoord, 2)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Colours may have an alpha channel, which we don't use
+	var colours []float32
+	colourComponents := 3
+	if colour, ok := primitive.Attributes["COLOR_0"]; ok {
+		if colour >= 0 && colour < len(self.document.Accessors) {
+			colourComponents = accessorComponents(self.document.Accessors[colour].Type)
+		}
+		colours, err = self.floats(colour, colourComponents)
+		if err != nil {
+			return err
+		}
+	}
+
+	var indices []uint32
+	if primitive.Indices != nil {
+		indices, err = self.indices(*primitive.Indices)
+		if err != nil {
+			return err
+		}
+	} else {
+		indices = make([]uint32, count)
+		for i := range(indices) {
+			indices[i] = uint32(i)
+		}
+	}
+
+	triangles, err := triangleList(indices, mode)
+	if err != nil {
+		return err
+	}
+
+	material := gltfDefaultMaterial
+	if primitive.Material != nil && *primitive.Material >= 0 && *primitive.Material < len(self.materialNames) {
+		material = self.materialNames[*primitive.Material]
+	}
+	if len(obj.Materials) == 0 || obj.Materials[len(obj.Materials)-1].Name != material {
+		handleMaterial(obj, material)
+	}
+
+	vertBase := uint32(len(obj.Vertices) / 3) + 1
+	for i := 0; i < count; i += 1 {
+		p := world.Mul4x1(mgl.Vec4{positions[i*3], positions[i*3+1], positions[i*3+2], 1})
+		obj.Vertices = append(obj.Vertices, p[0], p[1], p[2])
+		if len(colours) == count * colourComponents {
+			c := colours[i*colourComponents:]
+			obj.addColour(c[0], c[1], c[2])
+		}
+	}
+
+	var normalBase uint32
+	if len(normals) == count * 3 {
+		normalBase = uint32(len(obj.Normals) / 3) + 1
+		normalMatrix := world.Mat3().Inv().Transpose()
+		for i := 0; i < count; i += 1 {
+			n := normalMatrix.Mul3x1(mgl.Vec3{normals[i*3], normals[i*3+1], normals[i*3+2]})
+			if n.Len() > 0 {
+				n = n.Normalize()
+			}
+			obj.Normals = append(obj.Normals, n[0], n[1], n[2])
+		}
+	}
+
+	// glTF puts the origin of texture space at the top left, whereas obj and
+	// Finish expect it at the bottom left.
+	var texCoordBase uint32
+	if len(texCoords) == count * 2 {
+		texCoordBase = uint32(len(obj.TextureCoords) / 2) + 1
+		for i := 0; i < count; i += 1 {
+			obj.TextureCoords = append(obj.TextureCoords, texCoords[i*2], 1-texCoords[i*2+1])
+		}
+	}
+
+	// Mirroring transforms turn faces inside out unless we flip them back.
+	flip := world.Mat3().Det() < 0
+
+	skipped := 0
+	for i := 0; i + 2 < len(triangles); i += 3 {
+		a, b, c := triangles[i], triangles[i+1], triangles[i+2]
+		if a >= uint32(count) || b >= uint32(count) || c >= uint32(count) {
+			skipped += 1
+			continue
+		}
+		if flip {
+			b, c = c, b
+		}
+
+		for _, index := range([]uint32{a, b, c}) {
+			obj.FaceVerts = append(obj.FaceVerts, vertBase + index)
+			if normalBase != 0 {
+				obj.VertNormals = append(obj.VertNormals, normalBase + index)
+			} else {
+				obj.VertNormals = append(obj.VertNormals, 0)
+			}
+			if texCoordBase != 0 {
+				obj.VertTextureCoords = append(obj.VertTextureCoords, texCoordBase + index)
+			} else {
+				obj.VertTextureCoords = append(obj.VertTextureCoords, 0)
+			}
+		}
+		obj.FacePolygons = append(obj.FacePolygons, uint32(len(obj.FaceSmoothing)))
+		obj.FaceSmoothing = append(obj.FaceSmoothing, 0)
+	}
+
+	if skipped > 0 {
+		self.warn(SeverityError, BadIndex, fmt.Sprintf("skipped %v triangles with out of range indices", skipped))
+	}
+
+	return nil
+}
+
+func triangleList(indices []uint32, mode int) ([]uint32, error) {
+	switch mode {
+	case gltfTriangles:
+		return indices, nil
+
+	case gltfTriangleStrip:
+		var triangles []uint32
+		for i := 2; i < len(indices); i += 1 {
+			if i % 2 == 0 {
+				triangles = append(triangles, indices[i-2], indices[i-1], indices[i])
+			} else {
+				triangles = append(triangles, indices[i-1], indices[i-2], indices[i])
+			}
+		}
+		return triangles, nil
+
+	case gltfTriangleFan:
+		var triangles []uint32
+		for i := 2; i < len(indices); i += 1 {
+			triangles = append(triangles, indices[0], indices[i-1], indices[i])
+		}
+		return triangles, nil
+
+	default:
+		return nil, fmt.Errorf("primitive mode %v is not supported", mode)
+	}
+}
+
+// Find the bytes making up an accessor's elements, checking that they're all
+// actually inside the buffer.
+func (self *gltfImporter) accessor(index int, components int) (gltfAccessor, []byte, int, error) {
+	var accessor gltfAccessor
+	if index < 0 || index >= len(self.document.Accessors) {
+		return accessor, nil, 0, fmt.Errorf("accessor index %v out of range", index)
+	}
+	accessor = self.document.Accessors[index]
+
+	if len(accessor.Sparse) > 0 {
+		return accessor, nil, 0, fmt.Errorf("sparse accessors are not supported")
+	}
+	if accessorComponents(accessor.Type) != components {
+		return accessor, nil, 0, fmt.Errorf("accessor %v has type %v", index, accessor.Type)
+	}
+	if accessor.Count < 0 || accessor.Count * components > gltfMaxElements {
+		return accessor, nil, 0, fmt.Errorf("accessor %v has a bad count", index)
+	}
+	size := componentSize(accessor.ComponentType)
+	if size == 0 {
+		return accessor, nil, 0, fmt.Errorf("accessor %v has unknown component type %v", index, accessor.ComponentType)
+	}
+
+	// Accessors without a buffer view are all zeroes.
+	if accessor.BufferView == nil {
+		return accessor, nil, 0, nil
+	}
+	if *accessor.BufferView < 0 || *accessor.BufferView >= len(self.document.BufferViews) {
+		return accessor, nil, 0, fmt.Errorf("buffer view index %v out of range", *accessor.BufferView)
+	}
+	view := self.document.BufferViews[*accessor.BufferView]
+	if view.Buffer < 0 || view.Buffer >= len(self.buffers) {
+		return accessor, nil, 0, fmt.Errorf("buffer index %v out of range", view.Buffer)
+	}
+	buffer := self.buffers[view.Buffer]
+	if view.ByteOffset < 0 || view.ByteLength < 0 || view.ByteOffset + view.ByteLength > len(buffer) {
+		return accessor, nil, 0, fmt.Errorf("buffer view %v is outside its buffer", *accessor.BufferView)
+	}
+	data := buffer[view.ByteOffset:view.ByteOffset+view.ByteLength]
+
+	stride := view.ByteStride
+	if stride == 0 {
+		stride = size * components
+	}
+	if accessor.Count > 0 {
+		end := accessor.ByteOffset + stride * (accessor.Count - 1) + size * components
+		if accessor.ByteOffset < 0 || stride < 0 || end > len(data) {
+			return accessor, nil, 0, fmt.Errorf("accessor %v is outside its buffer view", index)
+		}
+	}
+
+	return accessor, data[accessor.ByteOffset:], stride, nil
+}
+
+func (self *gltfImporter) floats(index int, components int) ([]float32, error) {
+	accessor, data, stride, err := self.accessor(index, components)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]float32, accessor.Count * components)
+	if data == nil {
+		return values, nil
+	}
+
+	size := componentSize(accessor.ComponentType)
+	for i := 0; i < accessor.Count; i += 1 {
+		for c := 0; c < components; c += 1 {
+			values[i*components+c] = readComponent(data[i*stride+c*size:], accessor.ComponentType, accessor.Normalized)
+		}
+	}
+
+	return values, nil
+}
+
+func (self *gltfImporter) indices(index int) ([]uint32, error) {
+	accessor, data, stride, err := self.accessor(index, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	indices := make([]uint32, accessor.Count)
+	if data == nil {
+		return indices, nil
+	}
+
+	for i := range(indices) {
+		element := data[i*stride:]
+		switch accessor.ComponentType {
+		case gltfUnsignedByte:
+			indices[i] = uint32(element[0])
+		case gltfUnsignedShort:
+			indices[i] = uint32(binary.LittleEndian.Uint16(element))
+		case gltfUnsignedInt:
+			indices[i] = binary.LittleEndian.Uint32(element)
+		default:
+			return nil, fmt.Errorf("indices have component type %v", accessor.ComponentType)
+		}
+	}
+
+	return indices, nil
+}
+
+func readComponent(data []byte, componentType int, normalized bool) float32 {
+	var value, scale float32
+	switch componentType {
+	case gltfFloat:
+		return math.Float32frombits(binary.LittleEndian.Uint32(data))
+	case gltfByte:
+		value, scale = float32(int8(data[0])), 127
+	case gltfUnsignedByte:
+		value, scale = float32(data[0]), 255
+	case gltfShort:
+		value, scale = float32(int16(binary.LittleEndian.Uint16(data))), 32767
+	case gltfUnsignedShort:
+		value, scale = float32(binary.LittleEndian.Uint16(data)), 65535
+	case gltfUnsignedInt:
+		value, scale = float32(binary.LittleEndian.Uint32(data)), 4294967295
+	}
+
+	if !normalized {
+		return value
+	}
+	value = value / scale
+	if value < -1 {
+		value = -1
+	}
+	return value
+}
+
+func componentSize(componentType int) int {
+	switch componentType {
+	case gltfByte, gltfUnsignedByte:
+		return 1
+	case gltfShort, gltfUnsignedShort:
+		return 2
+	case gltfUnsignedInt, gltfFloat:
+		return 4
+	}
+	return 0
+}
+
+func accessorComponents(kind string) int {
+	switch kind {
+	case "SCALAR":
+		return 1
+	case "VEC2":
+		return 2
+	case "VEC3":
+		return 3
+	case "VEC4":
+		return 4
+	}
+	return 0
+}
+
+func (self *gltfImporter) warn(severity Severity, code WarningCode, warning string) {
+	self.warnings = append(self.warnings, &Warning{
+		Severity: severity,
+		Code: code,
+		Warning: warning,
+	})
+}
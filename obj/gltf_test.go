@@ -0,0 +1,223 @@
+package obj
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// One triangle: three float32 positions followed by three uint16 indices.
+func triangleBuffer() []byte {
+	var buffer bytes.Buffer
+	for _, value := range([]float32{0, 0, 0, 1, 0, 0, 0, 1, 0}) {
+		binary.Write(&buffer, binary.LittleEndian, math.Float32bits(value))
+	}
+	binary.Write(&buffer, binary.LittleEndian, []uint16{0, 1, 2, 0})
+	return buffer.Bytes()
+}
+
+// A document with one triangle mesh and the given nodes and scenes. The
+// buffer is embedded unless uri is set.
+func gltfSource(nodes string, scenes string, uri string) string {
+	if uri == "" {
+		uri = "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(triangleBuffer())
+	}
+	return fmt.Sprintf(`{
+	"asset": {"version": "2.0"},
+	%v
+	"nodes": %v,
+	"meshes": [{"name": "triangle", "primitives": [{"attributes": {"POSITION": 0}, "indices": 1}]}],
+	"accessors": [
+		{"bufferView": 0, "componentType": 5126, "count": 3, "type": "VEC3"},
+		{"bufferView": 1, "componentType": 5123, "count": 3, "type": "SCALAR"}
+	],
+	"bufferViews": [
+		{"buffer": 0, "byteOffset": 0, "byteLength": 36},
+		{"buffer": 0, "byteOffset": 36, "byteLength": 6}
+	],
+	"buffers": [{"uri": %q, "byteLength": 44}]
+}`, scenes, nodes, uri)
+}
+
+func countCode(warnings []*Warning, code WarningCode) int {
+	count := 0
+	for _, warning := range(warnings) {
+		if warning.Code == code {
+			count += 1
+		}
+	}
+	return count
+}
+
+// Every node in a chain has the next one as both of its children, which
+// would be 2^n copies of the mesh if shared subtrees were followed.
+func doublingNodes(n int) string {
+	var nodes []string
+	for i := 0; i < n - 1; i += 1 {
+		nodes = append(nodes, fmt.Sprintf(`{"children": [%v, %v]}`, i + 1, i + 1))
+	}
+	nodes = append(nodes, `{"mesh": 0}`)
+	return "[" + strings.Join(nodes, ", ") + "]"
+}
+
+func TestReadGLTF(t *testing.T) {
+	tests := []struct{
+		name string
+		source string
+		triangles int
+		parts int
+		// Warnings with BadStructure or BadIndex
+		structure int
+		index int
+		max [3]float32
+	}{
+		{
+			name: "one node",
+			source: gltfSource(`[{"mesh": 0}]`, "", ""),
+			triangles: 1, parts: 1,
+			max: [3]float32{1, 1, 0},
+		},
+		{
+			name: "translated child",
+			source: gltfSource(`[{"children": [1], "translation": [1, 0, 0]}, {"mesh": 0, "translation": [0, 0, 2]}]`, "", ""),
+			triangles: 1, parts: 1,
+			max: [3]float32{2, 1, 2},
+		},
+		{
+			name: "scene picks its nodes",
+			source: gltfSource(`[{"mesh": 0}, {"mesh": 0, "translation": [5, 0, 0]}]`, `"scene": 0, "scenes": [{"nodes": [0]}],`, ""),
+			triangles: 1, parts: 1,
+			max: [3]float32{1, 1, 0},
+		},
+		{
+			name: "cycle",
+			source: gltfSource(`[{"mesh": 0, "children": [1]}, {"mesh": 0, "children": [0]}]`, `"scenes": [{"nodes": [0]}],`, ""),
+			triangles: 2, parts: 2, structure: 1,
+			max: [3]float32{1, 1, 0},
+		},
+		{
+			name: "shared child",
+			source: gltfSource(`[{"children": [1, 2]}, {"children": [3]}, {"children": [3]}, {"mesh": 0}]`, "", ""),
+			triangles: 1, parts: 1, structure: 1,
+			max: [3]float32{1, 1, 0},
+		},
+		{
+			name: "doubling",
+			source: gltfSource(doublingNodes(40), `"scenes": [{"nodes": [0]}],`, ""),
+			triangles: 1, parts: 1, structure: 39,
+			max: [3]float32{1, 1, 0},
+		},
+		{
+			name: "missing child",
+			source: gltfSource(`[{"mesh": 0, "children": [7]}]`, "", ""),
+			triangles: 1, parts: 1, index: 1,
+			max: [3]float32{1, 1, 0},
+		},
+	}
+
+	for _, test := range(tests) {
+		object, warnings, err := ReadGLTF(strings.NewReader(test.source), ".")
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		if triangles := len(object.Indices) / 3; triangles != test.triangles {
+			t.Errorf("%v: %v triangles, expected %v", test.name, triangles, test.triangles)
+		}
+		if len(object.Parts) != test.parts {
+			t.Errorf("%v: %v parts, expected %v", test.name, len(object.Parts), test.parts)
+		}
+		if count := countCode(warnings, BadStructure); count != test.structure {
+			t.Errorf("%v: %v structure warnings, expected %v: %v", test.name, count, test.structure, warnings)
+		}
+		if count := countCode(warnings, BadIndex); count != test.index {
+			t.Errorf("%v: %v index warnings, expected %v: %v", test.name, count, test.index, warnings)
+		}
+		if object.Bounds.Max != test.max {
+			t.Errorf("%v: bounds reach %v, expected %v", test.name, object.Bounds.Max, test.max)
+		}
+		err = object.Validate()
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+		}
+	}
+}
+
+func TestReadGLB(t *testing.T) {
+	json := []byte(strings.Replace(gltfSource(`[{"mesh": 0}]`, "", "x"), `"uri": "x", `, "", 1))
+	for len(json) % 4 != 0 {
+		json = append(json, ' ')
+	}
+	bin := triangleBuffer()
+
+	var glb bytes.Buffer
+	binary.Write(&glb, binary.LittleEndian, []uint32{glbMagic, 2, uint32(12 + 8 + len(json) + 8 + len(bin))})
+	binary.Write(&glb, binary.LittleEndian, []uint32{uint32(len(json)), glbChunkJSON})
+	glb.Write(json)
+	binary.Write(&glb, binary.LittleEndian, []uint32{uint32(len(bin)), glbChunkBIN})
+	glb.Write(bin)
+
+	object, _, err := ReadGLTF(&glb, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if triangles := len(object.Indices) / 3; triangles != 1 {
+		t.Errorf("%v triangles, expected 1", triangles)
+	}
+
+	truncated := glb.Bytes()
+	_, _, err = ReadGLTF(bytes.NewReader(truncated[:len(truncated) / 2]), ".")
+	if err == nil {
+		t.Errorf("a truncated glb should fail to load")
+	}
+}
+
+// Buffers in their own files are read relative to the document, and are part
+// of what a baked copy of it depends on.
+func TestGLTFExternalBuffer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gltf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "triangle.gltf")
+	source := gltfSource(`[{"mesh": 0}]`, "", "triangle%20data.bin")
+	err = ioutil.WriteFile(filename, []byte(source), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "triangle data.bin"), triangleBuffer(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	object, _, err := readFile(filename, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if triangles := len(object.Indices) / 3; triangles != 1 {
+		t.Errorf("%v triangles, expected 1", triangles)
+	}
+
+	dependencies := sourceDependencies(filename, []byte(source), object)
+	if len(dependencies) != 1 || dependencies[0] != "triangle data.bin" {
+		t.Errorf("expected the buffer to be a dependency, got %v", dependencies)
+	}
+	before := sourceHash(filename, []byte(source), dependencies)
+	buffer := triangleBuffer()
+	buffer[0] = 1
+	err = ioutil.WriteFile(filepath.Join(dir, "triangle data.bin"), buffer, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sourceHash(filename, []byte(source), dependencies) == before {
+		t.Errorf("changing the buffer didn't change the hash")
+	}
+}
@@ -0,0 +1,74 @@
+package obj
+
+import (
+	"sort"
+)
+
+// One level of detail, used from Distance onwards until a coarser level takes
+// over.
+type LOD struct{
+	Geometry *Object
+	Distance float32
+}
+
+type LODLevel struct{
+	// Fraction of the original triangles to keep.
+	Ratio float32
+	Distance float32
+}
+
+// Versions of an object at decreasing detail, ordered by distance.
+type LODSet struct{
+	Levels []LOD
+}
+
+// Build a set of simplified levels from an object, which is used as the most
+// detailed level for anything closer than the first of them. Each level is
+// simplified from the original so errors don't build up. The new levels are
+// bound, and have to be rebuilt if the original is reloaded.
+func MakeLODSet(object *Object, levels []LODLevel) *LODSet {
+	set := &LODSet{
+		Levels: []LOD{LOD{Geometry: object, Distance: 0}},
+	}
+
+	levels = append([]LODLevel{}, levels...)
+	sort.Slice(levels, func(i, j int) bool {
+		return levels[i].Distance < levels[j].Distance
+	})
+	for _, level := range(levels) {
+		geometry := object.Simplify(level.Ratio)
+		geometry.Bind()
+		set.Levels = append(set.Levels, LOD{Geometry: geometry, Distance: level.Distance})
+	}
+
+	return set
+}
+
+// The coarsest level meant to be seen from this distance. Parts may have been
+// hidden or moved since the levels were built, so the level is brought up to
+// date with the original's parts first.
+func (self LODSet) Select(distance float32) *Object {
+	original := self.Levels[0].Geometry
+	selected := original
+	for _, level := range(self.Levels) {
+		if distance < level.Distance {
+			break
+		}
+		selected = level.Geometry
+	}
+
+	if selected != original && len(selected.Parts) == len(original.Parts) {
+		for i, part := range(original.Parts) {
+			selected.Parts[i].Hidden = part.Hidden
+			selected.Parts[i].Transform = part.Transform
+		}
+	}
+	return selected
+}
+
+// Release the levels MakeLODSet created, but not the original object.
+func (self LODSet) Unbind() {
+	for _, level := range(self.Levels[1:]) {
+		level.Geometry.Unbind()
+	}
+}
@@ -0,0 +1,46 @@
+package obj
+
+import (
+	"testing"
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// Hiding or moving a part of the original shows at every distance, not just
+// up close.
+func TestLODSelect(t *testing.T) {
+	object, _, err := readFile("../resources/meshes/floor1.obj", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := LODSet{Levels: []LOD{
+		LOD{Geometry: object, Distance: 0},
+		LOD{Geometry: object.Simplify(0.5), Distance: 10},
+	}}
+
+	object.Parts[0].Hidden = true
+	object.Parts[0].Transform = mgl.Translate3D(0, 2, 0)
+
+	tests := []struct{
+		distance float32
+		level int
+	}{
+		{0, 0},
+		{9, 0},
+		{10, 1},
+		{100, 1},
+	}
+
+	for _, test := range(tests) {
+		selected := set.Select(test.distance)
+		if selected != set.Levels[test.level].Geometry {
+			t.Errorf("%v: selected the wrong level", test.distance)
+			continue
+		}
+		if !selected.Parts[0].Hidden {
+			t.Errorf("%v: hidden part is showing", test.distance)
+		}
+		if selected.Parts[0].Transform != object.Parts[0].Transform {
+			t.Errorf("%v: moved part is at %v", test.distance, selected.Parts[0].Transform)
+		}
+	}
+}
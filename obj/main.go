@@ -1,10 +1,12 @@
 package obj
 
 import (
-	"bufio"
 	"fmt"
+	tex "github.com/crabmusket/lowrezjam2017/tex"
+	mgl "github.com/go-gl/mathgl/mgl32"
 	"io"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 )
@@ -13,16 +15,46 @@ type Material struct{
 	Name string
 	Start uint32
 	End uint32
+	Description *MaterialDescription
+	Bounds Bounds
 }
 
 type Object struct{
 	Filename string
 	Id uint32
 	Vertices []float32
+	Format VertexFormat
 	Indices []uint32
 	Vbo uint32
 	Ebo uint32
 	Materials []Material
+	MaterialLibraries []string
+	Parts []*Part
+	Bounds Bounds
+	Stats Stats
+	// Drawn from instead of separate textures if set, see UseAtlas.
+	Atlas *tex.Atlas
+	options Options
+}
+
+// A named object (o) or group (g) within an obj file. Parts share the buffers
+// of the Object they belong to, and cover a range of its indices. Faces which
+// appear before any o or g statement end up in a part with no name.
+type Part struct{
+	Object string
+	Group string
+	Start uint32
+	End uint32
+	Materials []Material
+	Bounds Bounds
+	Hidden bool
+	Transform mgl.Mat4
+}
+
+// Vertex counts before and after Finish merges identical face corners.
+type Stats struct{
+	Corners int
+	Vertices int
 }
 
 type MaterialData struct{
@@ -32,177 +64,412 @@ type MaterialData struct{
 
 type ObjData struct{
 	Vertices []float32
+	// Colours of the vertices, if any were given. Vertices after the end of
+	// Colours are white.
+	Colours []float32
 	Normals []float32
 	TextureCoords []float32
 	FaceVerts []uint32
 	VertTextureCoords []uint32
 	VertNormals []uint32
+	FaceSmoothing []uint32
+	// The polygon each triangle was cut from, as the index of its first
+	// triangle.
+	FacePolygons []uint32
+	SmoothingGroup uint32
 	Materials []MaterialData
+	MaterialLibraries []string
+	Parts []PartData
 }
 
-type Warning struct {
-	Filename string
-	Line int
-	Warning string
+type PartData struct{
+	Object string
+	Group string
+	Start uint32
+}
+
+type vertexKey struct{
+	Vertex uint32
+	TextureCoords uint32
+	Normal uint32
 }
 
 func Load(filename string) (*Object, []*Warning, error) {
+	return LoadWith(filename, Options{})
+}
+
+func LoadWith(filename string, options Options) (*Object, []*Warning, error) {
+	obj, warnings, err := readFile(filename, options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	obj.Bind()
+
+	return obj, warnings, nil
+}
+
+// Read a mesh file in whichever format its extension says it's in.
+func readFile(filename string, options Options) (*Object, []*Warning, error) {
+	var obj *Object
+	var warnings []*Warning
+	var err error
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".gltf", ".glb":
+		obj, warnings, err = readGLTFFile(filename)
+	default:
+		obj, warnings, err = readObjFile(filename)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = options.check(warnings)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	options.apply(obj)
+	return obj, warnings, nil
+}
+
+// Read an obj file along with any material libraries it references.
+func readObjFile(filename string) (*Object, []*Warning, error) {
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, nil, err
 	}
 	defer file.Close()
 
-	obj, warnings, err := Read(file)
+	obj, warnings, err := read(file)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	obj.Bind()
-
 	obj.Filename = filename
 	for _, warning := range warnings {
 		warning.Filename = filename
 	}
 
+	libraryWarnings := obj.resolveMaterials(filepath.Dir(filename))
+	warnings = append(warnings, libraryWarnings...)
+
 	return obj, warnings, nil
 }
 
-func Read(reader io.Reader) (*Object, []*Warning, error) {
-	obj := new(ObjData)
+func (self *Object) resolveMaterials(dir string) []*Warning {
 	var warnings []*Warning
+	descriptions := make(MaterialLibrary)
+
+	for _, name := range self.MaterialLibraries {
+		libraryFilename := filepath.Join(dir, filepath.FromSlash(name))
+		library, libraryWarnings, err := LoadMaterialLibrary(libraryFilename)
+		if err != nil {
+			warnings = append(warnings, &Warning{
+				Filename: self.Filename,
+				Severity: SeverityWarning,
+				Code: MissingLibrary,
+				Warning: "could not load material library: " + err.Error(),
+			})
+			continue
+		}
 
-	index := 0
+		warnings = append(warnings, libraryWarnings...)
+		for key, description := range library {
+			descriptions[key] = description
+		}
+	}
 
-	scanner := bufio.NewScanner(reader)
-	for scanner.Scan() {
-		line := scanner.Text()
-		index += 1
+	if len(self.MaterialLibraries) == 0 {
+		return warnings
+	}
 
-		if len(line) == 0 {
-			continue
+	return append(warnings, self.describeMaterials(descriptions)...)
+}
+
+// Attach descriptions to the object's materials and its parts' materials.
+func (self *Object) describeMaterials(descriptions MaterialLibrary) []*Warning {
+	var warnings []*Warning
+
+	for i := range self.Materials {
+		material := &self.Materials[i]
+		material.Description = descriptions[material.Name]
+		if material.Description == nil {
+			warnings = append(warnings, &Warning{
+				Filename: self.Filename,
+				Severity: SeverityWarning,
+				Code: MissingMaterial,
+				Warning: "material not found in any library: " + material.Name,
+			})
 		}
-		if line[0] == '#' {
-			continue
+	}
+
+	for _, part := range self.Parts {
+		for i := range part.Materials {
+			part.Materials[i].Description = descriptions[part.Materials[i].Name]
 		}
+	}
+
+	return warnings
+}
+
+// The key of this material's diffuse texture in a tex.Library or tex.Atlas.
+// Materials with no diffuse map fall back to a texture named the same as the
+// material, which a Library draws as its placeholder unless one is loaded
+// under that name.
+func (self Material) TextureName() string {
+	if self.Description != nil && self.Description.DiffuseMap != "" {
+		return tex.Key(self.Description.DiffuseMap)
+	}
+	return self.Name
+}
+
+// The key of this material's normal map in a tex.Library, or "" if it
+// doesn't have one.
+func (self Material) NormalMapName() string {
+	if self.Description != nil && self.Description.BumpMap != "" {
+		return tex.Key(self.Description.BumpMap)
+	}
+	return ""
+}
+
+func Read(reader io.Reader) (*Object, []*Warning, error) {
+	return ReadWith(reader, Options{})
+}
+
+func ReadWith(reader io.Reader, options Options) (*Object, []*Warning, error) {
+	object, warnings, err := read(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = options.check(warnings)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	options.apply(object)
+	return object, warnings, nil
+}
+
+func read(reader io.Reader) (*Object, []*Warning, error) {
+	obj := new(ObjData)
+	var warnings []*Warning
+
+	scanner := newLineScanner(reader)
+	for scanner.Scan() {
+		components := scanner.Components
+		index := scanner.Line
 
-		components := strings.Split(line, " ")
 		switch components[0] {
 		case "o":
-			// TODO
-			continue
+			name := strings.Join(components[1:], " ")
+			obj.Parts = append(obj.Parts, PartData{
+				Object: name,
+				Start: uint32(len(obj.FaceVerts)),
+			})
+
+		case "g":
+			handleGroup(obj, strings.Join(components[1:], " "))
 
 		case "v":
-			if len(components) != 4 {
+			if len(components) != 4 && len(components) != 5 && len(components) != 7 && len(components) != 8 {
 				warnings = append(warnings, &Warning{
 					Line: index,
-					Warning: "vertex must have 3 space-separated components",
+					Column: scanner.Columns[0],
+					Severity: SeverityError,
+					Code: BadComponentCount,
+					Warning: "vertex must have 3 space-separated components, optionally followed by w and then r g b",
 				})
 				continue
 			}
 
 			lineWarnings := handleVertex(obj, components[1:])
-			for _, warning := range lineWarnings {
-				warning.Line = index
-			}
+			scanner.place(lineWarnings)
 			warnings = append(warnings, lineWarnings...)
 
 		case "vn":
 			if len(components) != 4 {
 				warnings = append(warnings, &Warning{
 					Line: index,
+					Column: scanner.Columns[0],
+					Severity: SeverityError,
+					Code: BadComponentCount,
 					Warning: "vertex normal must have 3 space-separated components",
 				})
 				continue
 			}
 
 			lineWarnings := handleVertexNormal(obj, components[1:])
-			for _, warning := range lineWarnings {
-				warning.Line = index
-			}
+			scanner.place(lineWarnings)
 			warnings = append(warnings, lineWarnings...)
 
 		case "vt":
 			if len(components) != 3 {
 				warnings = append(warnings, &Warning{
 					Line: index,
+					Column: scanner.Columns[0],
+					Severity: SeverityError,
+					Code: BadComponentCount,
 					Warning: "texture coordinates must have 2 space-separated components",
 				})
 				continue
 			}
 
 			lineWarnings := handleTextureCoords(obj, components[1:])
-			for _, warning := range lineWarnings {
-				warning.Line = index
-			}
+			scanner.place(lineWarnings)
 			warnings = append(warnings, lineWarnings...)
 
 		case "f":
-			if len(components) != 4 {
+			if len(components) < 4 {
 				warnings = append(warnings, &Warning{
 					Line: index,
-					Warning: "face must have 3 space-separated components",
+					Column: scanner.Columns[0],
+					Severity: SeverityError,
+					Code: BadComponentCount,
+					Warning: "face must have at least 3 space-separated components",
 				})
 				continue
 			}
 
 			lineWarnings := handleFace(obj, components[1:])
-			for _, warning := range lineWarnings {
-				warning.Line = index
+			scanner.place(lineWarnings)
+			warnings = append(warnings, lineWarnings...)
+
+		case "mtllib":
+			if len(components) < 2 {
+				warnings = append(warnings, &Warning{
+					Line: index,
+					Column: scanner.Columns[0],
+					Severity: SeverityWarning,
+					Code: BadComponentCount,
+					Warning: "material library statement has no filename",
+				})
+				continue
+			}
+			obj.MaterialLibraries = append(obj.MaterialLibraries, components[1:]...)
+
+		case "s":
+			if len(components) != 2 {
+				warnings = append(warnings, &Warning{
+					Line: index,
+					Column: scanner.Columns[0],
+					Severity: SeverityError,
+					Code: BadComponentCount,
+					Warning: "smoothing group must have 1 space-separated component",
+				})
+				continue
 			}
+
+			lineWarnings := handleSmoothingGroup(obj, components[1])
+			scanner.place(lineWarnings)
 			warnings = append(warnings, lineWarnings...)
 
 		case "usemtl":
 			if len(components) != 2 {
+				warnings = append(warnings, &Warning{
+					Line: index,
+					Column: scanner.Columns[0],
+					Severity: SeverityError,
+					Code: BadComponentCount,
+					Warning: "material name must be a single component",
+				})
 				continue
 			}
 			handleMaterial(obj, components[1])
 
 		default:
-			continue
+			warnings = append(warnings, &Warning{
+				Line: index,
+				Column: scanner.Columns[0],
+				Severity: SeverityInfo,
+				Code: UnsupportedDirective,
+				Warning: "ignored unsupported statement: " + components[0],
+			})
 		}
 	}
 
-	object, err := obj.Finish()
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	object, finishWarnings, err := obj.Finish()
 	if err != nil {
 		return nil, nil, err
 	}
+	warnings = append(warnings, finishWarnings...)
 
 	return object, warnings, nil
 }
 
-func (self ObjData) Finish() (*Object, error) {
-	numVerts := len(self.FaceVerts)
-	stride := 3 + 3 + 2
+func (self ObjData) Finish() (*Object, []*Warning, error) {
+	warnings := self.fillNormals()
+	warnings = append(warnings, self.fillTextureCoords()...)
+
+	numCorners := len(self.FaceVerts)
+	format := DefaultFormat
+	if len(self.Colours) > 0 {
+		format = append(append(VertexFormat{}, DefaultFormat...), Colour)
+	}
+	stride := format.Stride()
 
 	object := &Object{
-		Indices: make([]uint32, numVerts),
-		Vertices: make([]float32, numVerts * stride),
+		Format: format,
+		Indices: make([]uint32, numCorners),
+		Vertices: make([]float32, 0, numCorners * stride),
 		Materials: make([]Material, len(self.Materials)),
 	}
 
-	for vert := 0; vert < numVerts; vert += 1 {
-		// For now don't bother indexing properly. Just do what you do.
-		object.Indices[vert] = uint32(vert)
+	// Corners which share the same position, normal and texture coordinates
+	// become a single vertex in the buffer.
+	unique := make(map[vertexKey]uint32)
+
+	for corner := 0; corner < numCorners; corner += 1 {
+		key := vertexKey{
+			Vertex: self.FaceVerts[corner],
+			TextureCoords: self.VertTextureCoords[corner],
+			Normal: self.VertNormals[corner],
+		}
+
+		if existing, ok := unique[key]; ok {
+			object.Indices[corner] = existing
+			continue
+		}
 
-		begin := vert * stride
-		vertIndex := (self.FaceVerts[vert] - 1) * 3
-		copy(object.Vertices[begin:begin+3], self.Vertices[vertIndex:vertIndex+3])
+		vert := uint32(len(object.Vertices) / stride)
+		unique[key] = vert
+		object.Indices[corner] = vert
 
-		normal := begin + 3
-		normalIndex := (self.VertNormals[vert] - 1) * 3
-		copy(object.Vertices[normal:normal+3], self.Normals[normalIndex:normalIndex+3])
+		vertIndex := (key.Vertex - 1) * 3
+		object.Vertices = append(object.Vertices, self.Vertices[vertIndex:vertIndex+3]...)
 
-		texture := normal + 3
-		textureIndex := (self.VertTextureCoords[vert] - 1) * 2
-		correctCoords := []float32{self.TextureCoords[textureIndex], 1-self.TextureCoords[textureIndex+1]}
-		copy(object.Vertices[texture:texture+2], correctCoords)
+		normalIndex := (key.Normal - 1) * 3
+		object.Vertices = append(object.Vertices, self.Normals[normalIndex:normalIndex+3]...)
+
+		textureIndex := (key.TextureCoords - 1) * 2
+		object.Vertices = append(object.Vertices, self.TextureCoords[textureIndex], 1-self.TextureCoords[textureIndex+1])
+
+		if format.Has(Colour) {
+			if int(vertIndex) + 3 <= len(self.Colours) {
+				object.Vertices = append(object.Vertices, self.Colours[vertIndex:vertIndex+3]...)
+			} else {
+				object.Vertices = append(object.Vertices, 1, 1, 1)
+			}
+		}
+	}
+
+	object.Stats = Stats{
+		Corners: numCorners,
+		Vertices: len(object.Vertices) / stride,
 	}
 
 	if len(object.Vertices) == 0 || len(object.Indices) == 0 {
-		return nil, fmt.Errorf("obj data is empty")
+		return nil, nil, fmt.Errorf("obj data is empty")
 	}
 
+	object.MaterialLibraries = self.MaterialLibraries
+
 	numMaterials := len(self.Materials)
 	for i, material := range(self.Materials) {
 		object.Materials[i].Name = material.Name
@@ -210,33 +477,193 @@ func (self ObjData) Finish() (*Object, error) {
 		if i < numMaterials-1 {
 			object.Materials[i].End = self.Materials[i+1].Start
 		} else {
-			object.Materials[i].End = uint32(numVerts)
+			object.Materials[i].End = uint32(numCorners)
 		}
 	}
 
-	return object, nil
+	object.Parts = self.finishParts(object)
+	object.updateBounds()
+
+	return object, warnings, nil
 }
 
+func (self ObjData) finishParts(object *Object) []*Part {
+	var parts []*Part
+	numCorners := uint32(len(object.Indices))
+
+	declared := self.Parts
+	if len(declared) == 0 || declared[0].Start > 0 {
+		declared = append([]PartData{PartData{}}, declared...)
+	}
+
+	for i, data := range(declared) {
+		end := numCorners
+		if i < len(declared)-1 {
+			end = declared[i+1].Start
+		}
+		if end <= data.Start {
+			continue
+		}
+
+		part := &Part{
+			Object: data.Object,
+			Group: data.Group,
+			Start: data.Start,
+			End: end,
+			Transform: mgl.Ident4(),
+		}
+
+		for _, material := range(object.Materials) {
+			start := material.Start
+			if start < part.Start {
+				start = part.Start
+			}
+			end := material.End
+			if end > part.End {
+				end = part.End
+			}
+			if end <= start {
+				continue
+			}
+			material.Start = start
+			material.End = end
+			part.Materials = append(part.Materials, material)
+		}
+
+		parts = append(parts, part)
+	}
+
+	return parts
+}
+
+// Number of floats per vertex.
+func (self Object) Stride() int {
+	return self.Format.Stride()
+}
+
+// Check that an object's buffers and ranges agree with each other, so that
+// drawing it can't read past the end of anything.
+func (self Object) Validate() error {
+	stride := self.Format.Stride()
+	if !self.Format.Has(Position) || stride == 0 {
+		return fmt.Errorf("vertex format %v has no positions", self.Format)
+	}
+	if len(self.Vertices) % stride != 0 {
+		return fmt.Errorf("%v floats is not a whole number of %v float vertices", len(self.Vertices), stride)
+	}
+	if len(self.Indices) % 3 != 0 {
+		return fmt.Errorf("%v indices is not a whole number of triangles", len(self.Indices))
+	}
+
+	numVerts := uint32(len(self.Vertices) / stride)
+	for i, index := range(self.Indices) {
+		if index >= numVerts {
+			return fmt.Errorf("index %v refers to vertex %v of %v", i, index, numVerts)
+		}
+	}
+
+	numCorners := uint32(len(self.Indices))
+	checkRange := func(kind string, name string, start uint32, end uint32, limit uint32) error {
+		if start > end || end > limit {
+			return fmt.Errorf("%v %q covers %v to %v of %v indices", kind, name, start, end, limit)
+		}
+		return nil
+	}
+	for _, material := range(self.Materials) {
+		err := checkRange("material", material.Name, material.Start, material.End, numCorners)
+		if err != nil {
+			return err
+		}
+	}
+	for _, part := range(self.Parts) {
+		err := checkRange("part", part.Name(), part.Start, part.End, numCorners)
+		if err != nil {
+			return err
+		}
+		for _, material := range(part.Materials) {
+			if material.Start < part.Start {
+				return fmt.Errorf("material %q starts before part %q", material.Name, part.Name())
+			}
+			err := checkRange("material", material.Name, material.Start, material.End, part.End)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Find the first part with a matching object or group name.
+func (self Object) FindPart(name string) *Part {
+	for _, part := range(self.Parts) {
+		if part.Object == name || part.Group == name {
+			return part
+		}
+	}
+	return nil
+}
+
+// The group name if this part is a group, otherwise the object name.
+func (self Part) Name() string {
+	if self.Group != "" {
+		return self.Group
+	}
+	return self.Object
+}
+
+// Vertices are x y z, then an optional w which only matters for rational
+// curves, then an optional r g b colour as written by Blender and MeshLab.
 func handleVertex(obj *ObjData, components []string) []*Warning {
 	var warnings []*Warning
-	vertex := []float32{0, 0, 0}
+	vertex := []float32{0, 0, 0, 1, 1, 1, 1}
 
-	for i := 0; i < 3; i += 1 {
+	// Without a w, the colour starts straight after z
+	fields := []int{0, 1, 2, 3, 4, 5, 6}
+	if len(components) == 6 {
+		fields = []int{0, 1, 2, 4, 5, 6}
+	}
+
+	for i, field := range(fields[:len(components)]) {
 		v, err := strconv.ParseFloat(components[i], 32)
 		if err != nil {
 			warnings = append(warnings, &Warning{
+				Severity: SeverityError,
+				Code: BadNumber,
 				Warning: "could not parse vertex component: " + components[i],
+				token: i + 1,
 			})
 		} else {
-			vertex[i] = float32(v)
+			vertex[field] = float32(v)
 		}
 	}
 
+	if vertex[3] != 1 {
+		warnings = append(warnings, &Warning{
+			Severity: SeverityInfo,
+			Code: UnsupportedFeature,
+			Warning: "vertex weights are ignored",
+			token: 4,
+		})
+	}
+
 	obj.Vertices = append(obj.Vertices, vertex[0], vertex[1], vertex[2])
+	if len(components) >= 6 {
+		obj.addColour(vertex[4], vertex[5], vertex[6])
+	}
 
 	return warnings
 }
 
+// Set the colour of the last vertex added, making any before it which don't
+// have colours white.
+func (self *ObjData) addColour(r, g, b float32) {
+	for len(self.Colours) + 3 < len(self.Vertices) {
+		self.Colours = append(self.Colours, 1, 1, 1)
+	}
+	self.Colours = append(self.Colours, r, g, b)
+}
+
 func handleVertexNormal(obj *ObjData, components []string) []*Warning {
 	var warnings []*Warning
 	normal := []float32{0, 0, 0}
@@ -245,7 +672,10 @@ func handleVertexNormal(obj *ObjData, components []string) []*Warning {
 		v, err := strconv.ParseFloat(components[i], 32)
 		if err != nil {
 			warnings = append(warnings, &Warning{
+				Severity: SeverityError,
+				Code: BadNumber,
 				Warning: "could not parse vertex normal: " + components[i],
+				token: i + 1,
 			})
 		} else {
 			normal[i] = float32(v)
@@ -265,7 +695,10 @@ func handleTextureCoords(obj *ObjData, components []string) []*Warning {
 		v, err := strconv.ParseFloat(components[i], 32)
 		if err != nil {
 			warnings = append(warnings, &Warning{
+				Severity: SeverityError,
+				Code: BadNumber,
 				Warning: "could not parse texture coordinate: " + components[i],
+				token: i + 1,
 			})
 		} else {
 			coords[i] = float32(v)
@@ -279,21 +712,30 @@ func handleTextureCoords(obj *ObjData, components []string) []*Warning {
 
 func handleFace(obj *ObjData, components []string) []*Warning {
 	var warnings []*Warning
-	vertices := []uint32{0, 0, 0}
-	texCoords := []uint32{0, 0, 0}
-	normals := []uint32{0, 0, 0}
+	numCorners := len(components)
+	vertices := make([]uint32, numCorners)
+	texCoords := make([]uint32, numCorners)
+	normals := make([]uint32, numCorners)
 	numVertices := 0
-	numTexCoords := 0
-	numNormals := 0
 
-	for i := 0; i < 3; i += 1 {
+	for i := 0; i < numCorners; i += 1 {
 		subcomponents := strings.Split(components[i], "/")
 
 		if len(subcomponents) >= 1 {
 			v, err := strconv.ParseInt(subcomponents[0], 10, 32)
 			if err != nil {
 				warnings = append(warnings, &Warning{
+					Severity: SeverityError,
+					Code: BadNumber,
 					Warning: "could not parse face vertex index: " + components[i],
+					token: i + 1,
+				})
+			} else if v = resolveIndex(v, len(obj.Vertices) / 3); v == 0 {
+				warnings = append(warnings, &Warning{
+					Severity: SeverityError,
+					Code: BadIndex,
+					Warning: "face vertex index out of range: " + components[i],
+					token: i + 1,
 				})
 			} else {
 				vertices[i] = uint32(v)
@@ -306,11 +748,20 @@ func handleFace(obj *ObjData, components []string) []*Warning {
 				v, err := strconv.ParseInt(subcomponents[1], 10, 32)
 				if err != nil {
 					warnings = append(warnings, &Warning{
+						Severity: SeverityError,
+						Code: BadNumber,
 						Warning: "could not parse face vertex texture coordinate index: " + components[i],
+						token: i + 1,
+					})
+				} else if v = resolveIndex(v, len(obj.TextureCoords) / 2); v == 0 {
+					warnings = append(warnings, &Warning{
+						Severity: SeverityError,
+						Code: BadIndex,
+						Warning: "face vertex texture coordinate index out of range: " + components[i],
+						token: i + 1,
 					})
 				} else {
 					texCoords[i] = uint32(v)
-					numTexCoords += 1
 				}
 			}
 		}
@@ -320,37 +771,114 @@ func handleFace(obj *ObjData, components []string) []*Warning {
 				v, err := strconv.ParseInt(subcomponents[2], 10, 32)
 				if err != nil {
 					warnings = append(warnings, &Warning{
+						Severity: SeverityError,
+						Code: BadNumber,
 						Warning: "could not parse face vertex normal index: " + components[i],
+						token: i + 1,
+					})
+				} else if v = resolveIndex(v, len(obj.Normals) / 3); v == 0 {
+					warnings = append(warnings, &Warning{
+						Severity: SeverityError,
+						Code: BadIndex,
+						Warning: "face vertex normal index out of range: " + components[i],
+						token: i + 1,
 					})
 				} else {
 					normals[i] = uint32(v)
-					numNormals += 1
 				}
 			}
 		}
 
 		if len(subcomponents) >= 4 {
 			warnings = append(warnings, &Warning{
+				Severity: SeverityWarning,
+				Code: BadComponentCount,
 				Warning: "too many attributes in face element: " + components[i],
+				token: i + 1,
 			})
 		}
 	}
 
-	if numVertices == 3 {
-		obj.FaceVerts = append(obj.FaceVerts, vertices[0], vertices[1], vertices[2])
+	if numVertices != numCorners {
+		return warnings
+	}
+
+	positions := make([][3]float32, numCorners)
+	for i, vertex := range(vertices) {
+		begin := (vertex - 1) * 3
+		copy(positions[i][:], obj.Vertices[begin:begin+3])
+	}
+
+	// Missing texture coordinates and normals are left as 0 for Finish to
+	// fill in.
+	triangles := triangulate(positions)
+	polygon := uint32(len(obj.FaceSmoothing))
+	for _, corner := range(triangles) {
+		obj.FaceVerts = append(obj.FaceVerts, vertices[corner])
+		obj.VertTextureCoords = append(obj.VertTextureCoords, texCoords[corner])
+		obj.VertNormals = append(obj.VertNormals, normals[corner])
+	}
+	for i := 0; i < len(triangles); i += 3 {
+		obj.FaceSmoothing = append(obj.FaceSmoothing, obj.SmoothingGroup)
+		obj.FacePolygons = append(obj.FacePolygons, polygon)
 	}
 
-	if numTexCoords == 3 {
-		obj.VertTextureCoords = append(obj.VertTextureCoords, texCoords[0], texCoords[1], texCoords[2])
+	return warnings
+}
+
+func handleSmoothingGroup(obj *ObjData, component string) []*Warning {
+	var warnings []*Warning
+
+	if component == "off" {
+		obj.SmoothingGroup = 0
+		return warnings
+	}
+	if component == "on" {
+		obj.SmoothingGroup = 1
+		return warnings
 	}
 
-	if numNormals == 3 {
-		obj.VertNormals = append(obj.VertNormals, normals[0], normals[1], normals[2])
+	v, err := strconv.ParseUint(component, 10, 32)
+	if err != nil {
+		warnings = append(warnings, &Warning{
+			Severity: SeverityWarning,
+			Code: BadNumber,
+			Warning: "could not parse smoothing group: " + component,
+			token: 1,
+		})
+	} else {
+		obj.SmoothingGroup = uint32(v)
 	}
 
 	return warnings
 }
 
+// Negative indices count backwards from the most recently defined element.
+// Returns 0 if the index doesn't refer to any element defined so far.
+func resolveIndex(index int64, count int) int64 {
+	if index < 0 {
+		index = int64(count) + 1 + index
+	}
+	if index < 1 || index > int64(count) {
+		return 0
+	}
+	return index
+}
+
+// Groups belong to the most recent object.
+func handleGroup(obj *ObjData, name string) {
+	object := ""
+	if len(obj.Parts) > 0 {
+		object = obj.Parts[len(obj.Parts)-1].Object
+	}
+
+	obj.Parts = append(obj.Parts, PartData{
+		Object: object,
+		Group: name,
+		Start: uint32(len(obj.FaceVerts)),
+	})
+}
+
 func handleMaterial(obj *ObjData, name string) {
 	obj.Materials = append(obj.Materials, MaterialData{
 		Name: name,
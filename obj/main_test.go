@@ -0,0 +1,125 @@
+package obj
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const dedupHeader = `
+v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+vt 0 0
+vt 1 0
+vt 1 1
+vt 0 1
+vn 0 0 1
+vn 0 0 -1
+`
+
+// Face corners with the same position, texture coordinates and normal share a
+// vertex, and any difference splits them.
+func TestReadDeduplicates(t *testing.T) {
+	tests := []struct{
+		name string
+		faces string
+		vertices int
+		indices []uint32
+	}{
+		{"shared edge", "f 1/1/1 2/2/1 3/3/1\nf 1/1/1 3/3/1 4/4/1\n", 4, []uint32{0, 1, 2, 0, 2, 3}},
+		{"quad", "f 1/1/1 2/2/1 3/3/1 4/4/1\n", 4, nil},
+		{"texture seam", "f 1/1/1 2/2/1 3/3/1\nf 1/2/1 3/3/1 4/4/1\n", 5, []uint32{0, 1, 2, 3, 2, 4}},
+		{"hard edge", "f 1/1/1 2/2/1 3/3/1\nf 1/1/2 3/3/2 4/4/2\n", 6, []uint32{0, 1, 2, 3, 4, 5}},
+		{"relative indices", "f 1/1/1 2/2/1 3/3/1\nf -4/-4/-2 -2/-2/-2 -1/-1/-2\n", 4, []uint32{0, 1, 2, 0, 2, 3}},
+		{"across materials", "usemtl a\nf 1/1/1 2/2/1 3/3/1\nusemtl b\nf 1/1/1 3/3/1 4/4/1\n", 4, []uint32{0, 1, 2, 0, 2, 3}},
+		{"across parts", "o a\nf 1/1/1 2/2/1 3/3/1\no b\nf 1/1/1 3/3/1 4/4/1\n", 4, []uint32{0, 1, 2, 0, 2, 3}},
+	}
+
+	for _, test := range(tests) {
+		object, _, err := Read(strings.NewReader(dedupHeader + test.faces))
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		vertices := len(object.Vertices) / object.Stride()
+		if vertices != test.vertices || object.Stats.Vertices != vertices {
+			t.Errorf("%v: %v vertices (stats say %v), expected %v", test.name, vertices, object.Stats.Vertices, test.vertices)
+		}
+		if object.Stats.Corners != len(object.Indices) {
+			t.Errorf("%v: stats say %v corners, but there are %v", test.name, object.Stats.Corners, len(object.Indices))
+		}
+		if test.indices != nil && !indicesEqual(object.Indices, test.indices) {
+			t.Errorf("%v: indices %v, expected %v", test.name, object.Indices, test.indices)
+		}
+	}
+}
+
+// Generated flat normals belong to a whole polygon, so the triangles cut from
+// it still share vertices.
+func TestReadFlatNormals(t *testing.T) {
+	tests := []struct{
+		name string
+		source string
+		vertices int
+		normals int
+	}{
+		{"quad", "f 1 2 3 4\n", 4, 1},
+		{"pentagon", "v 0.5 2 0\nf 1 2 3 5 4\n", 5, 1},
+		{"two triangles", "f 1 2 3\nf 1 3 4\n", 6, 1},
+		{"two quads", "v 0 0 1\nv 1 0 1\nf 1 2 3 4\nf 2 1 5 6\n", 8, 2},
+		{"given normals", "f 1//1 2//1 3//1 4//1\n", 4, 1},
+		{"smooth", "s 1\nf 1 2 3\nf 1 3 4\n", 4, 1},
+	}
+
+	for _, test := range(tests) {
+		object, _, err := Read(strings.NewReader("v 0 0 0\nv 1 0 0\nv 1 1 0\nv 0 1 0\nvn 0 0 1\n" + test.source))
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		if vertices := len(object.Vertices) / object.Stride(); vertices != test.vertices {
+			t.Errorf("%v: %v vertices, expected %v", test.name, vertices, test.vertices)
+		}
+
+		normals := make(map[[3]float32]bool)
+		for i := 0; i < len(object.Vertices); i += object.Stride() {
+			n := object.Vertices[i+object.Format.Offset(Normal):]
+			normals[[3]float32{n[0], n[1], n[2]}] = true
+		}
+		if len(normals) != test.normals {
+			t.Errorf("%v: %v different normals, expected %v", test.name, len(normals), test.normals)
+		}
+	}
+}
+
+// Read should only ever return warnings or errors for bad input, never panic.
+// The meshes make big seeds, so run with something like -fuzzminimizetime 2s
+// or the fuzzer spends most of its time shrinking what it finds.
+func FuzzRead(f *testing.F) {
+	seeds, err := filepath.Glob("../resources/meshes/*.obj")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, seed := range(seeds) {
+		data, err := ioutil.ReadFile(seed)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Add([]byte("v 1 2 3\nv -1 -2 -3\nvt 0 0\nf -1/-1 -2/1 1/1/1 \\\n 2\n"))
+	f.Add([]byte("o a\ng b\nusemtl c\ns 1\nf 1 2 3\n"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		object, _, err := Read(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		err = object.Validate()
+		if err != nil {
+			t.Errorf("Read returned an invalid object: %v", err)
+		}
+	})
+}
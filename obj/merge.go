@@ -0,0 +1,182 @@
+package obj
+
+import (
+	"fmt"
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// One placement of an object in a batch.
+type Instance struct{
+	Object *Object
+	Transform mgl.Mat4
+}
+
+// Merge several objects into one static batch, with each instance's transform
+// (and each visible part's own transform) baked into its vertices. Materials
+// which use the same texture are grouped into a single range, so the batch
+// needs one draw call per texture no matter how many instances it holds.
+//
+// The batch has a single unnamed part. Hidden parts are left out, as are faces
+// which aren't covered by any material since they would never be drawn. All
+// the objects must have the same vertex format. The result isn't bound, so
+// call Bind before rendering it.
+func Merge(instances []Instance) (*Object, error) {
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("nothing to merge")
+	}
+
+	format := instances[0].Object.Format
+	for _, instance := range(instances) {
+		if !sameFormat(instance.Object.Format, format) {
+			return nil, fmt.Errorf("can't merge %v with format %v into format %v", instance.Object.Filename, instance.Object.Format, format)
+		}
+	}
+
+	// Gather ranges of indices by texture, keeping textures in the order they
+	// first appear.
+	type span struct{
+		instance int
+		part *Part
+		material Material
+	}
+	var textures []string
+	groups := make(map[string][]span)
+	for i, instance := range(instances) {
+		for _, part := range(instance.Object.Parts) {
+			if part.Hidden {
+				continue
+			}
+			for _, material := range(part.Materials) {
+				name := material.TextureName()
+				if _, ok := groups[name]; !ok {
+					textures = append(textures, name)
+				}
+				groups[name] = append(groups[name], span{i, part, material})
+			}
+		}
+	}
+
+	batch := &Object{Format: format}
+	libraries := make(map[string]bool)
+	for _, instance := range(instances) {
+		for _, library := range(instance.Object.MaterialLibraries) {
+			if !libraries[library] {
+				libraries[library] = true
+				batch.MaterialLibraries = append(batch.MaterialLibraries, library)
+			}
+		}
+	}
+
+	// Vertices are copied once per part they're used in, since each part may
+	// be moved differently.
+	type copied struct{
+		instance int
+		part *Part
+		vert uint32
+	}
+	vertices := make(map[copied]uint32)
+
+	for _, name := range(textures) {
+		spans := groups[name]
+		material := Material{
+			Name: spans[0].material.Name,
+			Description: spans[0].material.Description,
+			Start: uint32(len(batch.Indices)),
+		}
+
+		for _, s := range(spans) {
+			object := instances[s.instance].Object
+			model := instances[s.instance].Transform.Mul4(s.part.Transform)
+			indices := object.Indices[s.material.Start:s.material.End]
+			// Mirroring turns faces inside out
+			flip := model.Mat3().Det() < 0
+
+			triangle := make([]uint32, 3)
+			for i := 0; i + 2 < len(indices); i += 3 {
+				for c := 0; c < 3; c += 1 {
+					key := copied{s.instance, s.part, indices[i+c]}
+					vert, ok := vertices[key]
+					if !ok {
+						vert = uint32(len(batch.Vertices) / format.Stride())
+						vertices[key] = vert
+						batch.Vertices = append(batch.Vertices, transformVertex(object, indices[i+c], model)...)
+					}
+					triangle[c] = vert
+				}
+				if flip {
+					triangle[1], triangle[2] = triangle[2], triangle[1]
+				}
+				batch.Indices = append(batch.Indices, triangle...)
+			}
+		}
+
+		material.End = uint32(len(batch.Indices))
+		batch.Materials = append(batch.Materials, material)
+	}
+
+	if len(batch.Indices) == 0 {
+		return nil, fmt.Errorf("merged batch is empty")
+	}
+
+	batch.Parts = []*Part{&Part{
+		Start: 0,
+		End: uint32(len(batch.Indices)),
+		Materials: append([]Material{}, batch.Materials...),
+		Transform: mgl.Ident4(),
+	}}
+	batch.Stats = Stats{
+		Corners: len(batch.Indices),
+		Vertices: len(batch.Vertices) / format.Stride(),
+	}
+	batch.updateBounds()
+
+	return batch, nil
+}
+
+func sameFormat(a VertexFormat, b VertexFormat) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range(a) {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Copy one vertex of an object, moving it by a model matrix. Normals and
+// tangents are rotated but not translated, and normals use the inverse
+// transpose so they stay perpendicular to non-uniformly scaled faces.
+func transformVertex(object *Object, vert uint32, model mgl.Mat4) []float32 {
+	format := object.Format
+	stride := format.Stride()
+	vertex := append([]float32{}, object.Vertices[int(vert)*stride:int(vert+1)*stride]...)
+
+	normalMatrix := model.Mat3().Inv().Transpose()
+	for _, attribute := range(format) {
+		v := vertex[format.Offset(attribute):]
+		switch attribute {
+		case Position:
+			p := mgl.TransformCoordinate(mgl.Vec3{v[0], v[1], v[2]}, model)
+			copy(v, p[:])
+		case Normal:
+			n := normalMatrix.Mul3x1(mgl.Vec3{v[0], v[1], v[2]})
+			if n.Len() > 0 {
+				n = n.Normalize()
+			}
+			copy(v, n[:])
+		case Tangent:
+			t := model.Mat3().Mul3x1(mgl.Vec3{v[0], v[1], v[2]})
+			if t.Len() > 0 {
+				t = t.Normalize()
+			}
+			copy(v, t[:])
+			if model.Mat3().Det() < 0 {
+				v[3] = -v[3]
+			}
+		}
+	}
+
+	return vertex
+}
@@ -0,0 +1,132 @@
+package obj
+
+import (
+	"strings"
+	"testing"
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// A quad split into two parts with a material each.
+const mergeSource = `
+v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+vt 0 0
+vt 1 0
+vt 1 1
+vt 0 1
+vn 0 0 1
+o a
+usemtl red
+f 1/1/1 2/2/1 3/3/1
+o b
+usemtl blue
+f 1/1/1 3/3/1 4/4/1
+`
+
+func mergeObject(t *testing.T, change func(object *Object)) *Object {
+	object, _, err := Read(strings.NewReader(mergeSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change != nil {
+		change(object)
+	}
+	return object
+}
+
+func TestMerge(t *testing.T) {
+	quad := mergeObject(t, nil)
+	hidden := mergeObject(t, func(object *Object) {
+		object.Parts[1].Hidden = true
+	})
+	moved := mergeObject(t, func(object *Object) {
+		object.Parts[0].Transform = mgl.Translate3D(0, 0, 1)
+	})
+	// Both materials draw from the same texture
+	shared := mergeObject(t, func(object *Object) {
+		for _, part := range(object.Parts) {
+			for i := range(part.Materials) {
+				part.Materials[i].Description = &MaterialDescription{Name: part.Materials[i].Name, DiffuseMap: "wall.png"}
+			}
+		}
+	})
+	allHidden := mergeObject(t, func(object *Object) {
+		for _, part := range(object.Parts) {
+			part.Hidden = true
+		}
+	})
+	unlike := mergeObject(t, func(object *Object) {
+		object.Format = VertexFormat{Position, Normal}
+	})
+
+	tests := []struct{
+		name string
+		instances []Instance
+		triangles int
+		vertices int
+		materials int
+		max [3]float32
+		fails bool
+	}{
+		{"one instance", []Instance{{quad, mgl.Ident4()}}, 2, 6, 2, [3]float32{1, 1, 0}, false},
+		{"two instances", []Instance{{quad, mgl.Ident4()}, {quad, mgl.Translate3D(2, 0, 0)}}, 4, 12, 2, [3]float32{3, 1, 0}, false},
+		{"hidden part", []Instance{{hidden, mgl.Ident4()}}, 1, 3, 1, [3]float32{1, 1, 0}, false},
+		{"moved part", []Instance{{moved, mgl.Ident4()}}, 2, 6, 2, [3]float32{1, 1, 1}, false},
+		{"shared texture", []Instance{{shared, mgl.Ident4()}, {quad, mgl.Ident4()}}, 4, 12, 3, [3]float32{1, 1, 0}, false},
+		{"mirrored", []Instance{{quad, mgl.Scale3D(-1, 1, 1)}}, 2, 6, 2, [3]float32{0, 1, 0}, false},
+		{"nothing", nil, 0, 0, 0, [3]float32{}, true},
+		{"all hidden", []Instance{{allHidden, mgl.Ident4()}}, 0, 0, 0, [3]float32{}, true},
+		{"different formats", []Instance{{quad, mgl.Ident4()}, {unlike, mgl.Ident4()}}, 0, 0, 0, [3]float32{}, true},
+	}
+
+	for _, test := range(tests) {
+		batch, err := Merge(test.instances)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%v: expected an error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		err = batch.Validate()
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+		}
+
+		if triangles := len(batch.Indices) / 3; triangles != test.triangles {
+			t.Errorf("%v: %v triangles, expected %v", test.name, triangles, test.triangles)
+		}
+		if vertices := len(batch.Vertices) / batch.Stride(); vertices != test.vertices || batch.Stats.Vertices != vertices {
+			t.Errorf("%v: %v vertices (stats say %v), expected %v", test.name, vertices, batch.Stats.Vertices, test.vertices)
+		}
+		if len(batch.Materials) != test.materials {
+			t.Errorf("%v: %v materials, expected %v", test.name, len(batch.Materials), test.materials)
+		}
+		if len(batch.Parts) != 1 || batch.Parts[0].End != uint32(len(batch.Indices)) {
+			t.Errorf("%v: expected one part covering the batch, got %v", test.name, batch.Parts)
+		}
+		if batch.Bounds.Max != test.max {
+			t.Errorf("%v: bounds reach %v, expected %v", test.name, batch.Bounds.Max, test.max)
+		}
+
+		// Every triangle still faces the way its normals point
+		format := batch.Format
+		stride := format.Stride()
+		for i := 0; i + 2 < len(batch.Indices); i += 3 {
+			var corners [3][3]float32
+			for c := 0; c < 3; c += 1 {
+				v := batch.Vertices[int(batch.Indices[i+c])*stride+format.Offset(Position):]
+				corners[c] = [3]float32{v[0], v[1], v[2]}
+			}
+			n := batch.Vertices[int(batch.Indices[i])*stride+format.Offset(Normal):]
+			face := cross3(corners[0], corners[1], corners[2])
+			if face[0] * float64(n[0]) + face[1] * float64(n[1]) + face[2] * float64(n[2]) <= 0 {
+				t.Errorf("%v: triangle %v faces away from its normal", test.name, batch.Indices[i:i+3])
+			}
+		}
+	}
+}
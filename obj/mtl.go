@@ -0,0 +1,233 @@
+package obj
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Surface properties of a material from a Wavefront .mtl library. Texture
+// paths are resolved relative to the library file when it is loaded by name.
+type MaterialDescription struct{
+	Name string
+	Ambient [3]float32
+	Diffuse [3]float32
+	Specular [3]float32
+	Shininess float32
+	Dissolve float32
+	Illumination int
+	DiffuseMap string
+	BumpMap string
+}
+
+type MaterialLibrary map[string]*MaterialDescription
+
+func LoadMaterialLibrary(filename string) (MaterialLibrary, []*Warning, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	library, warnings, err := ReadMaterialLibrary(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dir := filepath.Dir(filename)
+	for _, material := range library {
+		if material.DiffuseMap != "" && !filepath.IsAbs(material.DiffuseMap) {
+			material.DiffuseMap = filepath.Join(dir, material.DiffuseMap)
+		}
+		if material.BumpMap != "" && !filepath.IsAbs(material.BumpMap) {
+			material.BumpMap = filepath.Join(dir, material.BumpMap)
+		}
+	}
+
+	for _, warning := range warnings {
+		warning.Filename = filename
+	}
+
+	return library, warnings, nil
+}
+
+func ReadMaterialLibrary(reader io.Reader) (MaterialLibrary, []*Warning, error) {
+	library := make(MaterialLibrary)
+	var warnings []*Warning
+	var material *MaterialDescription
+
+	scanner := newLineScanner(reader)
+	for scanner.Scan() {
+		components := scanner.Components
+		index := scanner.Line
+
+		if components[0] == "newmtl" {
+			if len(components) != 2 {
+				warnings = append(warnings, &Warning{
+					Line: index,
+					Column: scanner.Columns[0],
+					Severity: SeverityError,
+					Code: BadComponentCount,
+					Warning: "material name must be a single component",
+				})
+				material = nil
+				continue
+			}
+
+			material = &MaterialDescription{
+				Name: components[1],
+				Diffuse: [3]float32{1, 1, 1},
+				Dissolve: 1,
+			}
+			library[material.Name] = material
+			continue
+		}
+
+		if material == nil {
+			warnings = append(warnings, &Warning{
+				Line: index,
+				Column: scanner.Columns[0],
+				Severity: SeverityError,
+				Code: MisplacedStatement,
+				Warning: "material property before newmtl: " + components[0],
+			})
+			continue
+		}
+
+		var lineWarnings []*Warning
+		switch components[0] {
+		case "Ka":
+			lineWarnings = handleColour(&material.Ambient, components[1:])
+
+		case "Kd":
+			lineWarnings = handleColour(&material.Diffuse, components[1:])
+
+		case "Ks":
+			lineWarnings = handleColour(&material.Specular, components[1:])
+
+		case "Ns":
+			lineWarnings = handleScalar(&material.Shininess, components[1:])
+
+		case "d":
+			lineWarnings = handleScalar(&material.Dissolve, components[1:])
+
+		case "illum":
+			if len(components) != 2 {
+				lineWarnings = append(lineWarnings, &Warning{
+					Severity: SeverityWarning,
+					Code: BadComponentCount,
+					Warning: "illumination model must have 1 component",
+				})
+				break
+			}
+			v, err := strconv.Atoi(components[1])
+			if err != nil {
+				lineWarnings = append(lineWarnings, &Warning{
+					Severity: SeverityWarning,
+					Code: BadNumber,
+					Warning: "could not parse illumination model: " + components[1],
+					token: 1,
+				})
+			} else {
+				material.Illumination = v
+			}
+
+		case "map_Kd":
+			lineWarnings = handleMap(&material.DiffuseMap, components[1:])
+
+		case "map_Bump", "map_bump", "bump":
+			lineWarnings = handleMap(&material.BumpMap, components[1:])
+
+		default:
+			lineWarnings = append(lineWarnings, &Warning{
+				Severity: SeverityInfo,
+				Code: UnsupportedDirective,
+				Warning: "ignored unsupported statement: " + components[0],
+			})
+		}
+
+		scanner.place(lineWarnings)
+		warnings = append(warnings, lineWarnings...)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return library, warnings, nil
+}
+
+func handleColour(colour *[3]float32, components []string) []*Warning {
+	var warnings []*Warning
+
+	if len(components) != 3 {
+		return append(warnings, &Warning{
+			Severity: SeverityWarning,
+			Code: BadComponentCount,
+			Warning: "colour must have 3 space-separated components",
+		})
+	}
+
+	for i := 0; i < 3; i += 1 {
+		v, err := strconv.ParseFloat(components[i], 32)
+		if err != nil {
+			warnings = append(warnings, &Warning{
+				Severity: SeverityWarning,
+				Code: BadNumber,
+				Warning: "could not parse colour component: " + components[i],
+				token: i + 1,
+			})
+		} else {
+			colour[i] = float32(v)
+		}
+	}
+
+	return warnings
+}
+
+func handleScalar(value *float32, components []string) []*Warning {
+	var warnings []*Warning
+
+	if len(components) != 1 {
+		return append(warnings, &Warning{
+			Severity: SeverityWarning,
+			Code: BadComponentCount,
+			Warning: "value must have 1 component",
+		})
+	}
+
+	v, err := strconv.ParseFloat(components[0], 32)
+	if err != nil {
+		warnings = append(warnings, &Warning{
+			Severity: SeverityWarning,
+			Code: BadNumber,
+			Warning: "could not parse value: " + components[0],
+			token: 1,
+		})
+	} else {
+		*value = float32(v)
+	}
+
+	return warnings
+}
+
+// Map statements may carry options such as -s or -bm before the filename. We
+// don't use any of them, so just take the last component.
+func handleMap(filename *string, components []string) []*Warning {
+	var warnings []*Warning
+
+	if len(components) == 0 {
+		return append(warnings, &Warning{
+			Severity: SeverityWarning,
+			Code: BadComponentCount,
+			Warning: "texture map must have a filename",
+		})
+	}
+
+	name := strings.Replace(components[len(components)-1], "\\", "/", -1)
+	*filename = filepath.FromSlash(name)
+
+	return warnings
+}
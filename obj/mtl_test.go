@@ -0,0 +1,173 @@
+package obj
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// A material with the defaults newmtl gives it.
+func plainMaterial(name string) MaterialDescription {
+	return MaterialDescription{Name: name, Diffuse: [3]float32{1, 1, 1}, Dissolve: 1}
+}
+
+func TestReadMaterialLibrary(t *testing.T) {
+	shiny := plainMaterial("shiny")
+	shiny.Ambient = [3]float32{0.1, 0.2, 0.3}
+	shiny.Diffuse = [3]float32{0.5, 0.5, 0.5}
+	shiny.Specular = [3]float32{1, 1, 1}
+	shiny.Shininess = 96
+	shiny.Dissolve = 0.5
+	shiny.Illumination = 2
+
+	textured := plainMaterial("textured")
+	textured.DiffuseMap = filepath.FromSlash("textures/wall.png")
+	textured.BumpMap = filepath.FromSlash("textures/wall_normal.png")
+
+	halfParsed := plainMaterial("half")
+	halfParsed.Diffuse = [3]float32{0.5, 1, 0.25}
+
+	tests := []struct{
+		name string
+		source string
+		materials []MaterialDescription
+		warnings []WarningCode
+	}{
+		{"empty", "", nil, nil},
+		{"defaults", "newmtl plain\n", []MaterialDescription{plainMaterial("plain")}, nil},
+		{
+			"properties",
+			"# a comment\nnewmtl shiny\nKa 0.1 0.2 0.3\nKd 0.5 0.5 0.5\nKs 1 1 1\nNs 96\nd 0.5\nillum 2\n",
+			[]MaterialDescription{shiny},
+			nil,
+		},
+		{
+			"maps",
+			"newmtl textured\nmap_Kd textures/wall.png\nmap_Bump -bm 0.5 textures\\wall_normal.png\n",
+			[]MaterialDescription{textured},
+			nil,
+		},
+		{
+			"bump spellings",
+			"newmtl a\nbump textures/wall_normal.png\nnewmtl b\nmap_bump textures/wall_normal.png\n",
+			[]MaterialDescription{
+				{Name: "a", Diffuse: [3]float32{1, 1, 1}, Dissolve: 1, BumpMap: textured.BumpMap},
+				{Name: "b", Diffuse: [3]float32{1, 1, 1}, Dissolve: 1, BumpMap: textured.BumpMap},
+			},
+			nil,
+		},
+		{
+			"several materials",
+			"newmtl a\nKd 0 0 0\nnewmtl b\n",
+			[]MaterialDescription{{Name: "a", Dissolve: 1}, plainMaterial("b")},
+			nil,
+		},
+		{
+			"bad numbers",
+			"newmtl half\nKd 0.5 x 0.25\nNs shiny\nillum two\n",
+			[]MaterialDescription{halfParsed},
+			[]WarningCode{BadNumber, BadNumber, BadNumber},
+		},
+		{
+			"bad component counts",
+			"newmtl plain\nKd 1 1\nd\nNs 1 2\nillum\nmap_Kd\n",
+			[]MaterialDescription{plainMaterial("plain")},
+			[]WarningCode{BadComponentCount, BadComponentCount, BadComponentCount, BadComponentCount, BadComponentCount},
+		},
+		{
+			"property before newmtl",
+			"Kd 0 0 0\nnewmtl plain\n",
+			[]MaterialDescription{plainMaterial("plain")},
+			[]WarningCode{MisplacedStatement},
+		},
+		{
+			// Properties after a bad newmtl have nowhere to go
+			"bad name",
+			"newmtl two words\nKd 0 0 0\n",
+			nil,
+			[]WarningCode{BadComponentCount, MisplacedStatement},
+		},
+		{
+			"unsupported statement",
+			"newmtl plain\nTf 1 1 1\n",
+			[]MaterialDescription{plainMaterial("plain")},
+			[]WarningCode{UnsupportedDirective},
+		},
+	}
+
+	for _, test := range(tests) {
+		library, warnings, err := ReadMaterialLibrary(strings.NewReader(test.source))
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+
+		if len(library) != len(test.materials) {
+			t.Errorf("%v: %v materials, expected %v", test.name, len(library), len(test.materials))
+		}
+		for _, expected := range(test.materials) {
+			material, ok := library[expected.Name]
+			if !ok {
+				t.Errorf("%v: missing material %v", test.name, expected.Name)
+				continue
+			}
+			if !reflect.DeepEqual(*material, expected) {
+				t.Errorf("%v: got %+v, expected %+v", test.name, *material, expected)
+			}
+		}
+
+		var codes []WarningCode
+		for _, warning := range(warnings) {
+			codes = append(codes, warning.Code)
+			if warning.Line == 0 {
+				t.Errorf("%v: warning without a line: %v", test.name, warning)
+			}
+		}
+		if !reflect.DeepEqual(codes, test.warnings) {
+			t.Errorf("%v: warnings %v, expected %v", test.name, warnings, test.warnings)
+		}
+	}
+}
+
+// Maps are relative to the library, and warnings say which library they came
+// from.
+func TestLoadMaterialLibrary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mtl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	absolute := filepath.Join(dir, "elsewhere", "normal.png")
+	filename := filepath.Join(dir, "level.mtl")
+	source := "newmtl wall\nmap_Kd ../textures/wall.png\nmap_Bump " + filepath.ToSlash(absolute) + "\nTf 1 1 1\n"
+	err = ioutil.WriteFile(filename, []byte(source), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	library, warnings, err := LoadMaterialLibrary(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wall := library["wall"]
+	if wall == nil {
+		t.Fatalf("missing material wall")
+	}
+	if expected := filepath.Join(filepath.Dir(dir), "textures", "wall.png"); wall.DiffuseMap != expected {
+		t.Errorf("diffuse map %v, expected %v", wall.DiffuseMap, expected)
+	}
+	if wall.BumpMap != absolute {
+		t.Errorf("bump map %v, expected %v", wall.BumpMap, absolute)
+	}
+	if len(warnings) != 1 || warnings[0].Filename != filename {
+		t.Errorf("expected one warning from %v, got %v", filename, warnings)
+	}
+
+	_, _, err = LoadMaterialLibrary(filepath.Join(dir, "missing.mtl"))
+	if err == nil {
+		t.Errorf("loading a missing library should fail")
+	}
+}
@@ -0,0 +1,162 @@
+package obj
+
+import (
+	"fmt"
+	"math"
+)
+
+type smoothKey struct{
+	Group uint32
+	Vertex uint32
+}
+
+// Give every face corner without a normal a generated one. Faces outside any
+// smoothing group get a flat normal, shared by every triangle cut from the same
+// polygon; faces in a group share normals averaged over every face in that
+// group which touches the same vertex.
+func (self *ObjData) fillNormals() []*Warning {
+	var warnings []*Warning
+	numTriangles := len(self.FaceVerts) / 3
+
+	missing := false
+	for _, normal := range(self.VertNormals) {
+		if normal == 0 {
+			missing = true
+			break
+		}
+	}
+	if !missing {
+		return warnings
+	}
+
+	// Flat normals are summed over each polygon, indexed by its first triangle.
+	flatSums := make([][3]float32, numTriangles)
+	smoothSums := make(map[smoothKey][3]float32)
+	for triangle := 0; triangle < numTriangles; triangle += 1 {
+		// Leave the normal unnormalized so larger faces count for more when
+		// they're averaged.
+		normal := self.faceNormal(triangle)
+
+		group := self.FaceSmoothing[triangle]
+		if group == 0 {
+			polygon := self.FacePolygons[triangle]
+			sum := flatSums[polygon]
+			flatSums[polygon] = [3]float32{sum[0] + normal[0], sum[1] + normal[1], sum[2] + normal[2]}
+			continue
+		}
+		for corner := triangle * 3; corner < triangle * 3 + 3; corner += 1 {
+			key := smoothKey{Group: group, Vertex: self.FaceVerts[corner]}
+			sum := smoothSums[key]
+			smoothSums[key] = [3]float32{sum[0] + normal[0], sum[1] + normal[1], sum[2] + normal[2]}
+		}
+	}
+
+	numFlat := 0
+	numSmooth := 0
+	flatNormals := make([]uint32, numTriangles)
+	smoothNormals := make(map[smoothKey]uint32)
+	for triangle := 0; triangle < numTriangles; triangle += 1 {
+		group := self.FaceSmoothing[triangle]
+		polygon := self.FacePolygons[triangle]
+
+		for corner := triangle * 3; corner < triangle * 3 + 3; corner += 1 {
+			if self.VertNormals[corner] != 0 {
+				continue
+			}
+
+			if group == 0 {
+				if flatNormals[polygon] == 0 {
+					flatNormals[polygon] = self.addNormal(flatSums[polygon])
+				}
+				self.VertNormals[corner] = flatNormals[polygon]
+				numFlat += 1
+				continue
+			}
+
+			key := smoothKey{Group: group, Vertex: self.FaceVerts[corner]}
+			normal, ok := smoothNormals[key]
+			if !ok {
+				normal = self.addNormal(smoothSums[key])
+				smoothNormals[key] = normal
+			}
+			self.VertNormals[corner] = normal
+			numSmooth += 1
+		}
+	}
+
+	if numFlat > 0 {
+		warnings = append(warnings, &Warning{
+			Severity: SeverityInfo,
+			Code: MissingAttribute,
+			Warning: fmt.Sprintf("generated flat normals for %v face vertices", numFlat),
+		})
+	}
+	if numSmooth > 0 {
+		warnings = append(warnings, &Warning{
+			Severity: SeverityInfo,
+			Code: MissingAttribute,
+			Warning: fmt.Sprintf("generated smooth normals for %v face vertices", numSmooth),
+		})
+	}
+
+	return warnings
+}
+
+// Point every face corner without texture coordinates at a shared 0,0.
+func (self *ObjData) fillTextureCoords() []*Warning {
+	var warnings []*Warning
+	var fallback uint32
+	numMissing := 0
+
+	for corner, coords := range(self.VertTextureCoords) {
+		if coords != 0 {
+			continue
+		}
+		if fallback == 0 {
+			self.TextureCoords = append(self.TextureCoords, 0, 0)
+			fallback = uint32(len(self.TextureCoords) / 2)
+		}
+		self.VertTextureCoords[corner] = fallback
+		numMissing += 1
+	}
+
+	if numMissing > 0 {
+		warnings = append(warnings, &Warning{
+			Severity: SeverityInfo,
+			Code: MissingAttribute,
+			Warning: fmt.Sprintf("no texture coordinates for %v face vertices, using 0 0", numMissing),
+		})
+	}
+
+	return warnings
+}
+
+func (self ObjData) faceNormal(triangle int) [3]float32 {
+	var p [3][3]float32
+	for i := 0; i < 3; i += 1 {
+		begin := (self.FaceVerts[triangle * 3 + i] - 1) * 3
+		copy(p[i][:], self.Vertices[begin:begin+3])
+	}
+
+	a := [3]float32{p[1][0] - p[0][0], p[1][1] - p[0][1], p[1][2] - p[0][2]}
+	b := [3]float32{p[2][0] - p[0][0], p[2][1] - p[0][1], p[2][2] - p[0][2]}
+	return [3]float32{
+		a[1] * b[2] - a[2] * b[1],
+		a[2] * b[0] - a[0] * b[2],
+		a[0] * b[1] - a[1] * b[0],
+	}
+}
+
+// Append a normalized copy of normal and return its one-based index. Degenerate
+// faces have no direction to speak of, so they just point up.
+func (self *ObjData) addNormal(normal [3]float32) uint32 {
+	length := float32(math.Sqrt(float64(normal[0] * normal[0] + normal[1] * normal[1] + normal[2] * normal[2])))
+	if length > 0 {
+		normal = [3]float32{normal[0] / length, normal[1] / length, normal[2] / length}
+	} else {
+		normal = [3]float32{0, 1, 0}
+	}
+
+	self.Normals = append(self.Normals, normal[0], normal[1], normal[2])
+	return uint32(len(self.Normals) / 3)
+}
@@ -0,0 +1,593 @@
+package obj
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	mgl "github.com/go-gl/mathgl/mgl32"
+)
+
+// Make a lower detail copy of an object, aiming for ratio times as many
+// triangles, by collapsing edges in order of their quadric error (Garland and
+// Heckbert). Each collapse moves one corner of the mesh onto a neighbour, so
+// every vertex left keeps its original position, normal and texture
+// coordinates.
+//
+// UV seams, hard edges and the edges between materials or parts can only be
+// collapsed along, when every vertex at the corner being moved has a partner
+// on the same side of the seam at the other end, and collapses which bend them
+// cost more. Normals which differ by less than hardEdgeAngle don't count as a
+// hard edge. Corners on the edge of the mesh are never moved, and nor are
+// corners where seams meet, so a mesh made of many small pieces may not get
+// anywhere near ratio; the result has as few triangles as could be managed.
+// It isn't bound, so call Bind before rendering it.
+func (self *Object) Simplify(ratio float32) *Object {
+	s := newSimplifier(self)
+	s.lockBoundaries()
+	s.addRegions(self.Materials)
+	var ranges []Material
+	for _, part := range(self.Parts) {
+		ranges = append(ranges, Material{Start: part.Start, End: part.End})
+	}
+	s.addRegions(ranges)
+	s.addSeamQuadrics()
+
+	target := int(float32(len(s.triangles)) * ratio)
+	s.collapse(target)
+
+	return self.rebuild(s.triangles, s.alive)
+}
+
+// The simplifier works on corners, which are all the vertices with the same
+// position welded together. Triangles still refer to vertices, so that each
+// keeps the attributes it had.
+type simplifier struct{
+	triangles [][3]uint32
+	alive []bool
+	// Which material and part each triangle is in.
+	regions []int
+	// The corner each vertex is at, and where each corner is.
+	corners []int
+	positions []mgl.Vec3
+	// Triangles around each corner, including ones which have been removed.
+	around [][]int
+	quadrics []quadric
+	locked []bool
+	// Bumped whenever a corner moves, so queued collapses which were costed
+	// before then can be skipped.
+	versions []int
+	queue collapseQueue
+}
+
+func newSimplifier(object *Object) *simplifier {
+	stride := object.Format.Stride()
+	positionOffset := object.Format.Offset(Position)
+	numVerts := len(object.Vertices) / stride
+
+	s := &simplifier{
+		triangles: make([][3]uint32, len(object.Indices) / 3),
+		alive: make([]bool, len(object.Indices) / 3),
+		regions: make([]int, len(object.Indices) / 3),
+		corners: make([]int, numVerts),
+	}
+
+	// Vertices which are identical in every attribute are treated as one, even
+	// if Finish gave them different indices. So are vertices whose normals
+	// differ by less than hardEdgeAngle, since that's a slightly bumpy surface
+	// rather than an edge, and otherwise every corner of a flat shaded mesh
+	// would be on a seam.
+	normalOffset := object.Format.Offset(Normal)
+	same := make(map[string][]uint32)
+	canonical := make([]uint32, numVerts)
+	atPosition := make(map[mgl.Vec3]int)
+	for vert := 0; vert < numVerts; vert += 1 {
+		data := object.Vertices[vert*stride:(vert+1)*stride]
+		key := vertexString(withoutNormal(data, normalOffset))
+		canonical[vert] = uint32(vert)
+		for _, existing := range(same[key]) {
+			if similarNormals(object.Vertices[int(existing)*stride:], data, normalOffset) {
+				canonical[vert] = existing
+				break
+			}
+		}
+		if canonical[vert] == uint32(vert) {
+			same[key] = append(same[key], uint32(vert))
+		}
+
+		p := data[positionOffset:]
+		position := mgl.Vec3{p[0], p[1], p[2]}
+		corner, ok := atPosition[position]
+		if !ok {
+			corner = len(s.positions)
+			atPosition[position] = corner
+			s.positions = append(s.positions, position)
+		}
+		s.corners[vert] = corner
+	}
+
+	numCorners := len(s.positions)
+	s.around = make([][]int, numCorners)
+	s.quadrics = make([]quadric, numCorners)
+	s.locked = make([]bool, numCorners)
+	s.versions = make([]int, numCorners)
+
+	for t := range(s.triangles) {
+		for c := 0; c < 3; c += 1 {
+			vert := canonical[object.Indices[t*3+c]]
+			s.triangles[t][c] = vert
+			corner := s.corners[vert]
+			s.around[corner] = append(s.around[corner], t)
+		}
+		s.alive[t] = true
+
+		q := planeQuadric(s.corner(t, 0), s.corner(t, 1), s.corner(t, 2))
+		for c := 0; c < 3; c += 1 {
+			corner := s.corners[s.triangles[t][c]]
+			s.quadrics[corner] = s.quadrics[corner].add(q)
+		}
+	}
+
+	return s
+}
+
+// Vertices with identical attributes have the same string. Negative zero,
+// which flat normals often have, is written as zero.
+func vertexString(data []float32) string {
+	values := make([]float32, len(data))
+	for i, value := range(data) {
+		values[i] = value + 0
+	}
+	return fmt.Sprint(values)
+}
+
+// Normals which bend by less than this are on a smooth surface.
+var hardEdgeAngle = mgl.DegToRad(30)
+
+func withoutNormal(data []float32, normalOffset int) []float32 {
+	if normalOffset < 0 {
+		return data
+	}
+	return append(append([]float32{}, data[:normalOffset]...), data[normalOffset+3:]...)
+}
+
+func similarNormals(a, b []float32, normalOffset int) bool {
+	if normalOffset < 0 {
+		return true
+	}
+	m := mgl.Vec3{a[normalOffset], a[normalOffset+1], a[normalOffset+2]}
+	n := mgl.Vec3{b[normalOffset], b[normalOffset+1], b[normalOffset+2]}
+	if m.Len() == 0 || n.Len() == 0 {
+		return m == n
+	}
+	return m.Normalize().Dot(n.Normalize()) >= float32(math.Cos(float64(hardEdgeAngle)))
+}
+
+// Where corner c of triangle t is.
+func (self *simplifier) corner(t int, c int) mgl.Vec3 {
+	return self.positions[self.corners[self.triangles[t][c]]]
+}
+
+// An edge used by only one triangle is on the boundary of the mesh, and one
+// used by more than two isn't safe to collapse either.
+func (self *simplifier) lockBoundaries() {
+	type edge struct{
+		a, b int
+	}
+	uses := make(map[edge]int)
+	for _, triangle := range(self.triangles) {
+		for c := 0; c < 3; c += 1 {
+			a, b := self.corners[triangle[c]], self.corners[triangle[(c+1) % 3]]
+			if a > b {
+				a, b = b, a
+			}
+			uses[edge{a, b}] += 1
+		}
+	}
+	for e, count := range(uses) {
+		if count != 2 {
+			self.locked[e.a] = true
+			self.locked[e.b] = true
+		}
+	}
+}
+
+// Split the triangles into regions by which of the ranges they're in, on top
+// of any regions they're already split into. The edges between regions are
+// treated like seams.
+func (self *simplifier) addRegions(ranges []Material) {
+	for t := range(self.regions) {
+		self.regions[t] *= len(ranges) + 1
+	}
+	for i, r := range(ranges) {
+		for t := int(r.Start) / 3; t < int(r.End) / 3; t += 1 {
+			self.regions[t] += i + 1
+		}
+	}
+}
+
+// Seams and hard edges are where triangles which share an edge don't share
+// vertices, and the edges of materials and parts are where they aren't in the
+// same region. Their corners can still be collapsed along them, but each triangle
+// beside one also weights the plane through the edge at right angles to it, so
+// collapses which would bend the seam cost more.
+func (self *simplifier) addSeamQuadrics() {
+	type edge struct{
+		a, b int
+	}
+	beside := make(map[edge][]int)
+	for t, triangle := range(self.triangles) {
+		for c := 0; c < 3; c += 1 {
+			a, b := self.corners[triangle[c]], self.corners[triangle[(c+1) % 3]]
+			if a > b {
+				a, b = b, a
+			}
+			beside[edge{a, b}] = append(beside[edge{a, b}], t)
+		}
+	}
+
+	for e, triangles := range(beside) {
+		if len(triangles) != 2 {
+			continue
+		}
+		first, second := triangles[0], triangles[1]
+		if self.regions[first] == self.regions[second] && self.vertexAt(first, e.a) == self.vertexAt(second, e.a) && self.vertexAt(first, e.b) == self.vertexAt(second, e.b) {
+			continue
+		}
+		a, b := self.positions[e.a], self.positions[e.b]
+		for _, t := range(triangles) {
+			q := seamQuadric(a, b, triangleNormal([3]mgl.Vec3{self.corner(t, 0), self.corner(t, 1), self.corner(t, 2)}))
+			self.quadrics[e.a] = self.quadrics[e.a].add(q)
+			self.quadrics[e.b] = self.quadrics[e.b].add(q)
+		}
+	}
+}
+
+func (self *simplifier) collapse(target int) {
+	remaining := len(self.triangles)
+
+	for corner := range(self.around) {
+		self.queueCollapses(corner)
+	}
+
+	for remaining > target && self.queue.Len() > 0 {
+		candidate := heap.Pop(&self.queue).(*collapse)
+		if candidate.fromVersion != self.versions[candidate.from] || candidate.toVersion != self.versions[candidate.to] {
+			continue
+		}
+		from, to := candidate.from, candidate.to
+		partners := self.partners(from, to)
+		if partners == nil || !self.canCollapse(from, to) {
+			continue
+		}
+
+		// Triangles along the edge are removed, and the rest take on the
+		// vertex those triangles used at the corner we're moving to.
+		for _, t := range(self.around[from]) {
+			if self.alive[t] && self.uses(t, to) {
+				self.alive[t] = false
+				remaining -= 1
+			}
+		}
+		for _, t := range(self.around[from]) {
+			if !self.alive[t] {
+				continue
+			}
+			for c := 0; c < 3; c += 1 {
+				if vert := self.triangles[t][c]; self.corners[vert] == from {
+					self.triangles[t][c] = partners[side{vert, self.regions[t]}]
+				}
+			}
+			self.around[to] = append(self.around[to], t)
+		}
+		self.around[from] = nil
+		self.quadrics[to] = self.quadrics[to].add(self.quadrics[from])
+
+		// Collapses to or from the merged corner have a new cost. Whether the
+		// others are still allowed is checked when they come off the queue.
+		self.versions[from] += 1
+		self.versions[to] += 1
+		self.queueCollapses(to)
+		for _, corner := range(self.neighbours(to)) {
+			self.queueCollapse(corner, to)
+		}
+	}
+}
+
+// Queue every collapse which moves a corner onto one of its neighbours.
+func (self *simplifier) queueCollapses(corner int) {
+	for _, to := range(self.neighbours(corner)) {
+		self.queueCollapse(corner, to)
+	}
+}
+
+func (self *simplifier) queueCollapse(from int, to int) {
+	if self.locked[from] {
+		return
+	}
+	heap.Push(&self.queue, &collapse{
+		from: from,
+		to: to,
+		cost: self.quadrics[from].add(self.quadrics[to]).error(self.positions[to]),
+		fromVersion: self.versions[from],
+		toVersion: self.versions[to],
+	})
+}
+
+func (self *simplifier) neighbours(corner int) []int {
+	var neighbours []int
+	seen := make(map[int]bool)
+	for _, t := range(self.around[corner]) {
+		if !self.alive[t] {
+			continue
+		}
+		for _, vert := range(self.triangles[t]) {
+			other := self.corners[vert]
+			if other != corner && !seen[other] {
+				seen[other] = true
+				neighbours = append(neighbours, other)
+			}
+		}
+	}
+	return neighbours
+}
+
+// The vertex triangle t uses at a corner.
+func (self *simplifier) vertexAt(t int, corner int) uint32 {
+	for _, vert := range(self.triangles[t]) {
+		if self.corners[vert] == corner {
+			return vert
+		}
+	}
+	panic("triangle isn't at the corner")
+}
+
+// One side of a seam at a corner: a vertex, and the region of the triangles
+// using it there.
+type side struct{
+	vertex uint32
+	region int
+}
+
+// Which vertex at to each side of from becomes, or nil if the collapse isn't
+// allowed. The triangles along the edge pair them up: one pair if both sides
+// of the edge agree, or one for each side if the edge is part of a seam. A
+// side of from without a partner is on a seam which doesn't run along the
+// edge, and moving it would give its triangles the wrong attributes, or move
+// the edge of a material or part.
+func (self *simplifier) partners(from int, to int) map[side]uint32 {
+	partners := make(map[side]uint32)
+	for _, t := range(self.around[from]) {
+		if !self.alive[t] || !self.uses(t, to) {
+			continue
+		}
+		key := side{self.vertexAt(t, from), self.regions[t]}
+		partner := self.vertexAt(t, to)
+		if existing, ok := partners[key]; ok && existing != partner {
+			return nil
+		}
+		partners[key] = partner
+	}
+	for _, t := range(self.around[from]) {
+		if !self.alive[t] {
+			continue
+		}
+		if _, ok := partners[side{self.vertexAt(t, from), self.regions[t]}]; !ok {
+			return nil
+		}
+	}
+	return partners
+}
+
+func (self *simplifier) uses(t int, corner int) bool {
+	triangle := self.triangles[t]
+	return self.corners[triangle[0]] == corner || self.corners[triangle[1]] == corner || self.corners[triangle[2]] == corner
+}
+
+// A collapse is allowed if it keeps the mesh manifold and doesn't flip any of
+// the triangles which are left over.
+func (self *simplifier) canCollapse(from int, to int) bool {
+	// The only corners from and to may share are the opposite corners of the
+	// triangles along the edge between them.
+	opposite := make(map[int]bool)
+	for _, t := range(self.around[from]) {
+		if !self.alive[t] || !self.uses(t, to) {
+			continue
+		}
+		for _, vert := range(self.triangles[t]) {
+			opposite[self.corners[vert]] = true
+		}
+	}
+	toNeighbours := make(map[int]bool)
+	for _, corner := range(self.neighbours(to)) {
+		toNeighbours[corner] = true
+	}
+	for _, corner := range(self.neighbours(from)) {
+		if toNeighbours[corner] && !opposite[corner] {
+			return false
+		}
+	}
+
+	for _, t := range(self.around[from]) {
+		if !self.alive[t] || self.uses(t, to) {
+			continue
+		}
+		var before, after [3]mgl.Vec3
+		for c := 0; c < 3; c += 1 {
+			before[c] = self.corner(t, c)
+			after[c] = before[c]
+			if self.corners[self.triangles[t][c]] == from {
+				after[c] = self.positions[to]
+			}
+		}
+		n := triangleNormal(before)
+		m := triangleNormal(after)
+		if m.Len() == 0 || n.Dot(m) <= 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func triangleNormal(p [3]mgl.Vec3) mgl.Vec3 {
+	return p[1].Sub(p[0]).Cross(p[2].Sub(p[0]))
+}
+
+// Copy the triangles which are still alive into a new object, dropping unused
+// vertices and moving material and part ranges to match.
+func (self *Object) rebuild(triangles [][3]uint32, alive []bool) *Object {
+	stride := self.Format.Stride()
+	object := &Object{
+		Filename: self.Filename,
+		Format: self.Format,
+		MaterialLibraries: self.MaterialLibraries,
+		Atlas: self.Atlas,
+		options: self.options,
+	}
+
+	// kept[i] is how many triangles survive before triangle i
+	kept := make([]uint32, len(triangles)+1)
+	remap := make(map[uint32]uint32)
+	for t, triangle := range(triangles) {
+		kept[t+1] = kept[t]
+		if !alive[t] {
+			continue
+		}
+		kept[t+1] += 1
+		for _, vert := range(triangle) {
+			index, ok := remap[vert]
+			if !ok {
+				index = uint32(len(object.Vertices) / stride)
+				remap[vert] = index
+				object.Vertices = append(object.Vertices, self.Vertices[int(vert)*stride:int(vert+1)*stride]...)
+			}
+			object.Indices = append(object.Indices, index)
+		}
+	}
+
+	corner := func(old uint32) uint32 {
+		return kept[old/3] * 3
+	}
+	moveMaterials := func(materials []Material) []Material {
+		moved := make([]Material, len(materials))
+		for i, material := range(materials) {
+			moved[i] = material
+			moved[i].Start = corner(material.Start)
+			moved[i].End = corner(material.End)
+		}
+		return moved
+	}
+
+	object.Materials = moveMaterials(self.Materials)
+	for _, part := range(self.Parts) {
+		moved := *part
+		moved.Start = corner(part.Start)
+		moved.End = corner(part.End)
+		moved.Materials = moveMaterials(part.Materials)
+		object.Parts = append(object.Parts, &moved)
+	}
+
+	object.Stats = Stats{
+		Corners: len(object.Indices),
+		Vertices: len(object.Vertices) / stride,
+	}
+	object.updateBounds()
+
+	return object
+}
+
+// The symmetric matrix of a quadric error function, stored as its upper
+// triangle: a2 ab ac ad b2 bc bd c2 cd d2.
+type quadric [10]float64
+
+// The quadric measuring squared distance from a triangle's plane, weighted by
+// its area so that tiny triangles don't count as much as big ones.
+func planeQuadric(a, b, c mgl.Vec3) quadric {
+	n := b.Sub(a).Cross(c.Sub(a))
+	area := float64(n.Len()) / 2
+	if area == 0 {
+		return quadric{}
+	}
+	n = n.Normalize()
+	x, y, z := float64(n[0]), float64(n[1]), float64(n[2])
+	d := -(x*float64(a[0]) + y*float64(a[1]) + z*float64(a[2]))
+	return quadric{
+		x*x*area, x*y*area, x*z*area, x*d*area,
+		y*y*area, y*z*area, y*d*area,
+		z*z*area, z*d*area,
+		d*d*area,
+	}
+}
+
+// How much a seam resists bending compared to the surface around it.
+const seamWeight = 10
+
+// The quadric measuring squared distance from the plane through a-b at right
+// angles to a triangle with the given normal, weighted by the edge's length.
+func seamQuadric(a, b mgl.Vec3, normal mgl.Vec3) quadric {
+	edge := b.Sub(a)
+	n := edge.Cross(normal)
+	if n.Len() == 0 {
+		return quadric{}
+	}
+	n = n.Normalize()
+	weight := seamWeight * float64(edge.Dot(edge))
+	x, y, z := float64(n[0]), float64(n[1]), float64(n[2])
+	d := -(x*float64(a[0]) + y*float64(a[1]) + z*float64(a[2]))
+	return quadric{
+		x*x*weight, x*y*weight, x*z*weight, x*d*weight,
+		y*y*weight, y*z*weight, y*d*weight,
+		z*z*weight, z*d*weight,
+		d*d*weight,
+	}
+}
+
+func (self quadric) add(other quadric) quadric {
+	for i := range(self) {
+		self[i] += other[i]
+	}
+	return self
+}
+
+func (self quadric) error(point mgl.Vec3) float64 {
+	x, y, z := float64(point[0]), float64(point[1]), float64(point[2])
+	q := self
+	return q[0]*x*x + 2*q[1]*x*y + 2*q[2]*x*z + 2*q[3]*x +
+		q[4]*y*y + 2*q[5]*y*z + 2*q[6]*y +
+		q[7]*z*z + 2*q[8]*z +
+		q[9]
+}
+
+type collapse struct{
+	from int
+	to int
+	cost float64
+	fromVersion int
+	toVersion int
+}
+
+// A min-heap of collapses by cost.
+type collapseQueue []*collapse
+
+func (self collapseQueue) Len() int {
+	return len(self)
+}
+
+func (self collapseQueue) Less(i, j int) bool {
+	return self[i].cost < self[j].cost
+}
+
+func (self collapseQueue) Swap(i, j int) {
+	self[i], self[j] = self[j], self[i]
+}
+
+func (self *collapseQueue) Push(x interface{}) {
+	*self = append(*self, x.(*collapse))
+}
+
+func (self *collapseQueue) Pop() interface{} {
+	old := *self
+	last := old[len(old)-1]
+	*self = old[:len(old)-1]
+	return last
+}
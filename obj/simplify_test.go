@@ -0,0 +1,124 @@
+package obj
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// A flat size by size grid of quads in the xy plane. With a seam, the texture
+// coordinates jump halfway across, so the vertices down the middle column are
+// split in two.
+func gridSource(size int, seam bool) string {
+	var source strings.Builder
+	for y := 0; y <= size; y += 1 {
+		for x := 0; x <= size; x += 1 {
+			fmt.Fprintf(&source, "v %v %v 0\n", x, y)
+		}
+	}
+	for y := 0; y <= size; y += 1 {
+		for x := 0; x <= size; x += 1 {
+			fmt.Fprintf(&source, "vt %v %v\n", float32(x) / float32(size), float32(y) / float32(size))
+		}
+	}
+	// The other side of the seam
+	for y := 0; y <= size; y += 1 {
+		fmt.Fprintf(&source, "vt %v %v\n", 1, float32(y) / float32(size))
+	}
+	fmt.Fprintf(&source, "vn 0 0 1\n")
+
+	corner := func(x, y int, right bool) string {
+		v := y * (size + 1) + x + 1
+		vt := v
+		if seam && right && x == size / 2 {
+			vt = (size + 1) * (size + 1) + y + 1
+		}
+		return fmt.Sprintf("%v/%v/1", v, vt)
+	}
+	for y := 0; y < size; y += 1 {
+		for x := 0; x < size; x += 1 {
+			right := x >= size / 2
+			fmt.Fprintf(&source, "f %v %v %v\n", corner(x, y, right), corner(x+1, y, right), corner(x+1, y+1, right))
+			fmt.Fprintf(&source, "f %v %v %v\n", corner(x, y, right), corner(x+1, y+1, right), corner(x, y+1, right))
+		}
+	}
+	return source.String()
+}
+
+func TestSimplify(t *testing.T) {
+	tests := []struct{
+		name string
+		source string
+		ratio float32
+		// The most triangles the result may have
+		most int
+	}{
+		{"grid", gridSource(8, false), 0.5, 64},
+		{"grid to a quarter", gridSource(8, false), 0.25, 32},
+		{"grid with a seam", gridSource(8, true), 0.5, 64},
+		{"nothing to remove", gridSource(1, false), 0.1, 2},
+	}
+
+	for _, test := range(tests) {
+		object, _, err := Read(strings.NewReader(test.source))
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+
+		simplified := object.Simplify(test.ratio)
+		err = simplified.Validate()
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+		}
+		triangles := len(simplified.Indices) / 3
+		if triangles > test.most {
+			t.Errorf("%v: %v of %v triangles left, expected at most %v", test.name, triangles, len(object.Indices) / 3, test.most)
+		}
+		if simplified.Bounds.Min != object.Bounds.Min || simplified.Bounds.Max != object.Bounds.Max {
+			t.Errorf("%v: bounds %v became %v", test.name, object.Bounds, simplified.Bounds)
+		}
+		if !verticesFrom(object, simplified) {
+			t.Errorf("%v: simplified object has vertices which aren't in the original", test.name)
+		}
+	}
+}
+
+// Simplifying a mesh made of separate flat shaded pieces still removes
+// triangles, and removes more the lower the ratio.
+func TestSimplifyLevel(t *testing.T) {
+	object, _, err := readFile("../resources/meshes/floor1.obj", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := len(object.Indices) / 3
+	for _, ratio := range([]float32{0.75, 0.5, 0.25}) {
+		simplified := object.Simplify(ratio)
+		err := simplified.Validate()
+		if err != nil {
+			t.Fatalf("%v: %v", ratio, err)
+		}
+		if simplified.Atlas != object.Atlas {
+			t.Errorf("%v: atlas wasn't kept", ratio)
+		}
+		triangles := len(simplified.Indices) / 3
+		if triangles >= previous {
+			t.Errorf("%v: %v triangles, expected fewer than %v", ratio, triangles, previous)
+		}
+		previous = triangles
+	}
+}
+
+func verticesFrom(original *Object, simplified *Object) bool {
+	stride := original.Format.Stride()
+	have := make(map[string]bool)
+	for i := 0; i < len(original.Vertices); i += stride {
+		have[vertexString(original.Vertices[i:i+stride])] = true
+	}
+	for i := 0; i < len(simplified.Vertices); i += stride {
+		if !have[vertexString(simplified.Vertices[i:i+stride])] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,190 @@
+package obj
+
+import (
+	mgl "github.com/go-gl/mathgl/mgl32"
+	"math"
+)
+
+// Add a tangent to every vertex for normal mapping. As in MikkTSpace, each
+// face's tangent is weighted by the angle it makes at the vertex, then
+// orthogonalized against the vertex normal, and vertices shared by faces whose
+// texture is mirrored and faces whose texture isn't are split in two, since
+// one tangent can't be right for both. The fourth component is the handedness
+// of the bitangent, so a shader can rebuild it with
+// cross(normal, tangent.xyz) * tangent.w, pointing up the image as OpenGL
+// style (green up) normal maps expect. MikkTSpace splits vertices in a few
+// other cases too, so normal maps baked with it may not match exactly.
+func (self *Object) ComputeTangents() {
+	if self.Format.Has(Tangent) || !self.Format.Has(Normal) || !self.Format.Has(TextureCoords) {
+		return
+	}
+
+	oldStride := self.Format.Stride()
+	numVerts := len(self.Vertices) / oldStride
+	positionOffset := self.Format.Offset(Position)
+	normalOffset := self.Format.Offset(Normal)
+	texCoordOffset := self.Format.Offset(TextureCoords)
+
+	position := func(vert uint32) mgl.Vec3 {
+		v := self.Vertices[int(vert)*oldStride+positionOffset:]
+		return mgl.Vec3{v[0], v[1], v[2]}
+	}
+	// Texture coordinates are stored with v running down the image, but
+	// normal maps have green pointing up it, so v is flipped back to get the
+	// bitangent the right way round.
+	texCoords := func(vert uint32) mgl.Vec2 {
+		v := self.Vertices[int(vert)*oldStride+texCoordOffset:]
+		return mgl.Vec2{v[0], -v[1]}
+	}
+
+	type faceTangent struct{
+		tangent mgl.Vec3
+		bitangent mgl.Vec3
+		mirrored bool
+		ok bool
+	}
+	faces := make([]faceTangent, len(self.Indices) / 3)
+	const (
+		usedUnmirrored = 1 << iota
+		usedMirrored
+	)
+	used := make([]uint8, numVerts)
+
+	for i := 0; i + 2 < len(self.Indices); i += 3 {
+		corners := [3]uint32{self.Indices[i], self.Indices[i+1], self.Indices[i+2]}
+		p := [3]mgl.Vec3{position(corners[0]), position(corners[1]), position(corners[2])}
+		uv := [3]mgl.Vec2{texCoords(corners[0]), texCoords(corners[1]), texCoords(corners[2])}
+
+		edge1, edge2 := p[1].Sub(p[0]), p[2].Sub(p[0])
+		du1, dv1 := uv[1][0] - uv[0][0], uv[1][1] - uv[0][1]
+		du2, dv2 := uv[2][0] - uv[0][0], uv[2][1] - uv[0][1]
+
+		det := du1 * dv2 - du2 * dv1
+		if math.Abs(float64(det)) < 1e-12 {
+			// No usable texture mapping on this face
+			continue
+		}
+		tangent := edge1.Mul(dv2).Sub(edge2.Mul(dv1)).Mul(1 / det)
+		bitangent := edge2.Mul(du1).Sub(edge1.Mul(du2)).Mul(1 / det)
+		if tangent.Len() == 0 || bitangent.Len() == 0 {
+			continue
+		}
+
+		// tangent x bitangent is the face normal divided by det, so a face
+		// whose texture is mirrored has a negative det.
+		face := faceTangent{
+			tangent: tangent.Normalize(),
+			bitangent: bitangent.Normalize(),
+			mirrored: det < 0,
+			ok: true,
+		}
+		faces[i/3] = face
+		for _, vert := range(corners) {
+			if face.mirrored {
+				used[vert] |= usedMirrored
+			} else {
+				used[vert] |= usedUnmirrored
+			}
+		}
+	}
+
+	// Mirrored faces get their own copy of any vertex they share with faces
+	// which aren't.
+	vertices := self.Vertices[:len(self.Vertices):len(self.Vertices)]
+	mirror := make(map[uint32]uint32)
+	for vert := 0; vert < numVerts; vert += 1 {
+		if used[vert] == usedUnmirrored | usedMirrored {
+			mirror[uint32(vert)] = uint32(len(vertices) / oldStride)
+			vertices = append(vertices, self.Vertices[vert*oldStride:(vert+1)*oldStride]...)
+		}
+	}
+	indices := self.Indices
+	if len(mirror) > 0 {
+		indices = append([]uint32{}, self.Indices...)
+		for i := 0; i + 2 < len(indices); i += 3 {
+			if !faces[i/3].mirrored {
+				continue
+			}
+			for c := i; c < i + 3; c += 1 {
+				if copied, ok := mirror[indices[c]]; ok {
+					indices[c] = copied
+				}
+			}
+		}
+	}
+	numVerts = len(vertices) / oldStride
+
+	tangents := make([]mgl.Vec3, numVerts)
+	bitangents := make([]mgl.Vec3, numVerts)
+	for i := 0; i + 2 < len(indices); i += 3 {
+		face := faces[i/3]
+		if !face.ok {
+			continue
+		}
+		corners := [3]uint32{indices[i], indices[i+1], indices[i+2]}
+		p := [3]mgl.Vec3{position(self.Indices[i]), position(self.Indices[i+1]), position(self.Indices[i+2])}
+		for c := 0; c < 3; c += 1 {
+			weight := cornerAngle(p[c], p[(c+1) % 3], p[(c+2) % 3])
+			vert := corners[c]
+			tangents[vert] = tangents[vert].Add(face.tangent.Mul(weight))
+			bitangents[vert] = bitangents[vert].Add(face.bitangent.Mul(weight))
+		}
+	}
+
+	format := append(append(VertexFormat{}, self.Format...), Tangent)
+	converted := self.Format.convert(vertices, format)
+	stride := format.Stride()
+	tangentOffset := format.Offset(Tangent)
+
+	for vert := 0; vert < numVerts; vert += 1 {
+		n := vertices[vert*oldStride+normalOffset:]
+		normal := mgl.Vec3{n[0], n[1], n[2]}
+
+		// Gram-Schmidt
+		tangent := tangents[vert].Sub(normal.Mul(normal.Dot(tangents[vert])))
+		if tangent.Len() < 1e-6 {
+			tangent = perpendicular(normal)
+		}
+		tangent = tangent.Normalize()
+
+		handedness := float32(1)
+		if normal.Cross(tangent).Dot(bitangents[vert]) < 0 {
+			handedness = -1
+		}
+
+		copy(converted[vert*stride+tangentOffset:], []float32{tangent[0], tangent[1], tangent[2], handedness})
+	}
+
+	self.Format = format
+	self.Vertices = converted
+	self.Indices = indices
+	self.Stats.Vertices = numVerts
+}
+
+// The angle at corner a of the triangle a b c.
+func cornerAngle(a, b, c mgl.Vec3) float32 {
+	ab, ac := b.Sub(a), c.Sub(a)
+	if ab.Len() == 0 || ac.Len() == 0 {
+		return 0
+	}
+	cos := ab.Normalize().Dot(ac.Normalize())
+	if cos > 1 {
+		cos = 1
+	} else if cos < -1 {
+		cos = -1
+	}
+	return float32(math.Acos(float64(cos)))
+}
+
+// Any unit vector at right angles to normal.
+func perpendicular(normal mgl.Vec3) mgl.Vec3 {
+	axis := mgl.Vec3{1, 0, 0}
+	if math.Abs(float64(normal[0])) > 0.9 {
+		axis = mgl.Vec3{0, 1, 0}
+	}
+	perpendicular := axis.Sub(normal.Mul(normal.Dot(axis)))
+	if perpendicular.Len() == 0 {
+		return axis
+	}
+	return perpendicular.Normalize()
+}
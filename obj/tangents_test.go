@@ -0,0 +1,134 @@
+package obj
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestComputeTangents(t *testing.T) {
+	tests := []struct{
+		name string
+		source string
+		// How many vertices there should be afterwards
+		vertices int
+		// The tangent's x and handedness at the first corner of each face
+		faces [][2]float32
+		// Where cross(normal, tangent) * handedness points at every corner,
+		// which is up the image
+		bitangent [3]float32
+	}{
+		{
+			name: "quad",
+			source: `
+v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+vt 0 0
+vt 1 0
+vt 1 1
+vt 0 1
+vn 0 0 1
+f 1/1/1 2/2/1 3/3/1
+f 1/1/1 3/3/1 4/4/1
+`,
+			vertices: 4,
+			faces: [][2]float32{{1, 1}, {1, 1}},
+			bitangent: [3]float32{0, 1, 0},
+		},
+		{
+			name: "rotated texture",
+			source: `
+v 0 0 0
+v 1 0 0
+v 0 1 0
+vt 0 0
+vt 0 1
+vt 1 0
+vn 0 0 1
+f 1/1/1 2/2/1 3/3/1
+`,
+			vertices: 3,
+			faces: [][2]float32{{0, -1}},
+			bitangent: [3]float32{1, 0, 0},
+		},
+		{
+			// The second face's texture is a mirror image of the first's, and
+			// the two vertices along the edge they share are split.
+			name: "mirrored",
+			source: `
+v 0 0 0
+v 1 0 0
+v 0 1 0
+v -1 0 0
+vt 0 0
+vt 1 0
+vt 0 1
+vn 0 0 1
+f 1/1/1 2/2/1 3/3/1
+f 4/2/1 1/1/1 3/3/1
+`,
+			vertices: 6,
+			faces: [][2]float32{{1, 1}, {-1, -1}},
+			bitangent: [3]float32{0, 1, 0},
+		},
+	}
+
+	for _, test := range(tests) {
+		object, _, err := Read(strings.NewReader(test.source))
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		object.ComputeTangents()
+
+		err = object.Validate()
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		stride := object.Format.Stride()
+		if count := len(object.Vertices) / stride; count != test.vertices || object.Stats.Vertices != count {
+			t.Errorf("%v: %v vertices (stats say %v), expected %v", test.name, count, object.Stats.Vertices, test.vertices)
+		}
+
+		offset := object.Format.Offset(Tangent)
+		normalOffset := object.Format.Offset(Normal)
+		for i := 0; i < len(object.Indices); i += 1 {
+			tangent := object.Vertices[int(object.Indices[i])*stride+offset:][:4]
+			n := object.Vertices[int(object.Indices[i])*stride+normalOffset:][:3]
+			bitangent := [3]float32{
+				(n[1] * tangent[2] - n[2] * tangent[1]) * tangent[3],
+				(n[2] * tangent[0] - n[0] * tangent[2]) * tangent[3],
+				(n[0] * tangent[1] - n[1] * tangent[0]) * tangent[3],
+			}
+			if !verticesClose(bitangent[:], test.bitangent[:]) {
+				t.Errorf("%v: corner %v has bitangent %v, expected %v", test.name, i, bitangent, test.bitangent)
+			}
+			length := math.Sqrt(float64(tangent[0] * tangent[0] + tangent[1] * tangent[1] + tangent[2] * tangent[2]))
+			if math.Abs(length - 1) > 1e-5 {
+				t.Errorf("%v: corner %v has tangent %v, which isn't unit length", test.name, i, tangent)
+			}
+			// Every corner of a face should agree on handedness
+			expected := test.faces[i/3]
+			if tangent[3] != expected[1] {
+				t.Errorf("%v: corner %v has handedness %v, expected %v", test.name, i, tangent[3], expected[1])
+			}
+			if i % 3 == 0 && math.Abs(float64(tangent[0] - expected[0])) > 1e-5 {
+				t.Errorf("%v: face %v has tangent %v, expected x to be %v", test.name, i/3, tangent, expected[0])
+			}
+		}
+	}
+}
+
+func TestComputeTangentsTwice(t *testing.T) {
+	object, _, err := Read(strings.NewReader(roundTripSources["single triangle"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	object.ComputeTangents()
+	vertices := append([]float32{}, object.Vertices...)
+	object.ComputeTangents()
+	if !verticesClose(vertices, object.Vertices) {
+		t.Errorf("tangents were added again")
+	}
+}
@@ -0,0 +1,111 @@
+package obj
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+const maxLineLength = 1024 * 1024
+
+// Reads logical lines from obj and mtl files. Lines ending in a backslash are
+// joined with the next line, comments are stripped, and CRLF endings are
+// tolerated. Line is the number of the first physical line of the current
+// logical line. Columns holds the 1-based column of each component, and Lines
+// the physical line it's on, since a continued line's components can be spread
+// over several.
+type lineScanner struct{
+	scanner *bufio.Scanner
+	Line int
+	Components []string
+	Columns []int
+	Lines []int
+	physical int
+}
+
+func newLineScanner(reader io.Reader) *lineScanner {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, maxLineLength)
+	return &lineScanner{scanner: scanner}
+}
+
+// Advance to the next line which has any components in it.
+func (self *lineScanner) Scan() bool {
+	for {
+		self.Components, self.Columns, self.Lines = nil, nil, nil
+		continued := true
+		first := true
+
+		for continued {
+			if !self.scanner.Scan() {
+				if first {
+					return false
+				}
+				break
+			}
+			self.physical += 1
+			if first {
+				self.Line = self.physical
+				first = false
+			}
+
+			// A comment runs to the end of its physical line, so a backslash
+			// inside one doesn't continue the line.
+			line := self.scanner.Text()
+			if comment := strings.IndexByte(line, '#'); comment >= 0 {
+				line = line[:comment]
+			}
+			line = strings.TrimRight(line, " \t\r")
+			continued = strings.HasSuffix(line, "\\")
+			if continued {
+				line = line[:len(line)-1]
+			}
+
+			components, columns := fields(line)
+			for range(components) {
+				self.Lines = append(self.Lines, self.physical)
+			}
+			self.Components = append(self.Components, components...)
+			self.Columns = append(self.Columns, columns...)
+		}
+
+		if len(self.Components) > 0 {
+			return true
+		}
+	}
+}
+
+// Set the line and column of warnings raised about the current line.
+func (self *lineScanner) place(warnings []*Warning) {
+	for _, warning := range warnings {
+		warning.Line = self.Line
+		if warning.token < len(self.Columns) {
+			warning.Line = self.Lines[warning.token]
+			warning.Column = self.Columns[warning.token]
+		}
+	}
+}
+
+// Like strings.Fields, but also returns where each field starts.
+func fields(text string) ([]string, []int) {
+	var components []string
+	var columns []int
+
+	start := -1
+	for i := 0; i <= len(text); i += 1 {
+		space := i == len(text) || text[i] == ' ' || text[i] == '\t' || text[i] == '\r' || text[i] == '\v' || text[i] == '\f'
+		if space && start >= 0 {
+			components = append(components, text[start:i])
+			columns = append(columns, start+1)
+			start = -1
+		} else if !space && start < 0 {
+			start = i
+		}
+	}
+
+	return components, columns
+}
+
+func (self *lineScanner) Err() error {
+	return self.scanner.Err()
+}
@@ -0,0 +1,122 @@
+package obj
+
+import (
+	"strings"
+	"testing"
+)
+
+type scannedLine struct{
+	components string
+	lines []int
+	columns []int
+}
+
+var tokenizeTests = []struct{
+	name string
+	source string
+	expected []scannedLine
+}{
+	{
+		name: "plain lines",
+		source: "v 1 2 3\nf 1 2 3\n",
+		expected: []scannedLine{
+			{"v 1 2 3", []int{1, 1, 1, 1}, []int{1, 3, 5, 7}},
+			{"f 1 2 3", []int{2, 2, 2, 2}, []int{1, 3, 5, 7}},
+		},
+	},
+	{
+		name: "comments and blank lines are skipped",
+		source: "# header\n\n  \nv 1 2 3 # trailing\n",
+		expected: []scannedLine{
+			{"v 1 2 3", []int{4, 4, 4, 4}, []int{1, 3, 5, 7}},
+		},
+	},
+	{
+		name: "continued line",
+		source: "f 1 2 \\\n  3 4\nv 0 0 0\n",
+		expected: []scannedLine{
+			{"f 1 2 3 4", []int{1, 1, 1, 2, 2}, []int{1, 3, 5, 3, 5}},
+			{"v 0 0 0", []int{3, 3, 3, 3}, []int{1, 3, 5, 7}},
+		},
+	},
+	{
+		name: "backslash in a comment doesn't continue",
+		source: "# note \\\nv 1 2 3\n",
+		expected: []scannedLine{
+			{"v 1 2 3", []int{2, 2, 2, 2}, []int{1, 3, 5, 7}},
+		},
+	},
+	{
+		name: "comment after a continuation",
+		source: "f 1 2 \\ # more below\n3\n",
+		expected: []scannedLine{
+			{"f 1 2 3", []int{1, 1, 1, 2}, []int{1, 3, 5, 1}},
+		},
+	},
+	{
+		name: "CRLF and tabs",
+		source: "v\t1 2 3\r\nvn 0 0 1\r\n",
+		expected: []scannedLine{
+			{"v 1 2 3", []int{1, 1, 1, 1}, []int{1, 3, 5, 7}},
+			{"vn 0 0 1", []int{2, 2, 2, 2}, []int{1, 4, 6, 8}},
+		},
+	},
+	{
+		name: "continuation at the end of the file",
+		source: "v 1 2 3 \\",
+		expected: []scannedLine{
+			{"v 1 2 3", []int{1, 1, 1, 1}, []int{1, 3, 5, 7}},
+		},
+	},
+}
+
+func TestLineScanner(t *testing.T) {
+	for _, test := range(tokenizeTests) {
+		scanner := newLineScanner(strings.NewReader(test.source))
+		var scanned []scannedLine
+		for scanner.Scan() {
+			scanned = append(scanned, scannedLine{
+				components: strings.Join(scanner.Components, " "),
+				lines: scanner.Lines,
+				columns: scanner.Columns,
+			})
+		}
+
+		if len(scanned) != len(test.expected) {
+			t.Errorf("%v: got %v lines, expected %v", test.name, len(scanned), len(test.expected))
+			continue
+		}
+		for i, expected := range(test.expected) {
+			got := scanned[i]
+			if got.components != expected.components || !intsEqual(got.lines, expected.lines) || !intsEqual(got.columns, expected.columns) {
+				t.Errorf("%v: line %v was %q on lines %v at columns %v, expected %q on lines %v at columns %v",
+					test.name, i, got.components, got.lines, got.columns, expected.components, expected.lines, expected.columns)
+			}
+		}
+	}
+}
+
+func TestWarningsOnContinuedLines(t *testing.T) {
+	_, warnings, err := Read(strings.NewReader("v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\nf 1 2 \\\n  x\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) == 0 {
+		t.Fatal("expected a warning about the bad index")
+	}
+	if warnings[0].Line != 6 || warnings[0].Column != 3 {
+		t.Errorf("warning at %v:%v, expected 6:3", warnings[0].Line, warnings[0].Column)
+	}
+}
+
+func intsEqual(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range(a) {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+package obj
+
+import (
+	"math"
+)
+
+// Triangulate a polygon by ear clipping. The polygon is projected onto the axis
+// plane it faces most directly, so concave faces come out correctly as long as
+// they are roughly planar. Returns indices into positions, three per triangle,
+// keeping the winding order of the original polygon.
+func triangulate(positions [][3]float32) []int {
+	count := len(positions)
+	if count < 3 {
+		return nil
+	}
+	if count == 3 {
+		return []int{0, 1, 2}
+	}
+
+	// Newell's method gives a usable normal even for concave polygons.
+	var normal [3]float64
+	for i := 0; i < count; i += 1 {
+		a := positions[i]
+		b := positions[(i+1) % count]
+		normal[0] += float64((a[1] - b[1]) * (a[2] + b[2]))
+		normal[1] += float64((a[2] - b[2]) * (a[0] + b[0]))
+		normal[2] += float64((a[0] - b[0]) * (a[1] + b[1]))
+	}
+
+	// Drop the axis the normal points along most, and flip the remaining axes
+	// if needed so the projected polygon always winds counter-clockwise.
+	u, v := 1, 2
+	axis := 0
+	if math.Abs(normal[1]) > math.Abs(normal[axis]) {
+		axis = 1
+		u, v = 2, 0
+	}
+	if math.Abs(normal[2]) > math.Abs(normal[axis]) {
+		axis = 2
+		u, v = 0, 1
+	}
+	if normal[axis] < 0 {
+		u, v = v, u
+	}
+
+	points := make([][2]float64, count)
+	for i, position := range(positions) {
+		points[i] = [2]float64{float64(position[u]), float64(position[v])}
+	}
+
+	remaining := make([]int, count)
+	for i := range(remaining) {
+		remaining[i] = i
+	}
+
+	triangles := make([]int, 0, 3 * (count - 2))
+	for len(remaining) > 3 {
+		clipped := false
+		for i := 0; i < len(remaining); i += 1 {
+			prev := remaining[(i + len(remaining) - 1) % len(remaining)]
+			cur := remaining[i]
+			next := remaining[(i+1) % len(remaining)]
+
+			if !isEar(points, remaining, prev, cur, next) {
+				continue
+			}
+
+			triangles = append(triangles, prev, cur, next)
+			remaining = append(remaining[:i], remaining[i+1:]...)
+			clipped = true
+			break
+		}
+
+		// Self-intersecting or degenerate input has no ears left. Fan out what
+		// remains rather than losing the rest of the face.
+		if !clipped {
+			for i := 1; i < len(remaining)-1; i += 1 {
+				triangles = append(triangles, remaining[0], remaining[i], remaining[i+1])
+			}
+			return triangles
+		}
+	}
+
+	return append(triangles, remaining[0], remaining[1], remaining[2])
+}
+
+func isEar(points [][2]float64, remaining []int, prev, cur, next int) bool {
+	a, b, c := points[prev], points[cur], points[next]
+	if cross2(a, b, c) <= 0 {
+		// Reflex or collinear corner
+		return false
+	}
+
+	for _, other := range(remaining) {
+		if other == prev || other == cur || other == next {
+			continue
+		}
+		p := points[other]
+		if p == a || p == b || p == c {
+			continue
+		}
+		if cross2(a, b, p) >= 0 && cross2(b, c, p) >= 0 && cross2(c, a, p) >= 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func cross2(a, b, c [2]float64) float64 {
+	return (b[0] - a[0]) * (c[1] - a[1]) - (b[1] - a[1]) * (c[0] - a[0])
+}
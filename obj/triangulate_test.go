@@ -0,0 +1,90 @@
+package obj
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTriangulate(t *testing.T) {
+	tests := []struct{
+		name string
+		positions [][3]float32
+		// Area of the polygon, or 0 to skip checking it
+		area float64
+	}{
+		{"too few", [][3]float32{{0, 0, 0}, {1, 0, 0}}, 0},
+		{"triangle", [][3]float32{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}}, 0.5},
+		{"square", [][3]float32{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}}, 1},
+		{"pentagon", [][3]float32{{0, 0, 0}, {2, 0, 0}, {3, 1, 0}, {1, 2, 0}, {-1, 1, 0}}, 5},
+		{"L shape", [][3]float32{{0, 0, 0}, {2, 0, 0}, {2, 1, 0}, {1, 1, 0}, {1, 2, 0}, {0, 2, 0}}, 3},
+		// The first corner is reflex, so it can't be the first ear.
+		{"arrow", [][3]float32{{1, 1, 0}, {0, 2, 0}, {0, 0, 0}, {2, 0, 0}, {2, 2, 0}}, 3},
+		{"facing down", [][3]float32{{0, 0, 0}, {0, 0, 2}, {1, 0, 1}, {2, 0, 2}, {2, 0, 0}}, 3},
+		{"facing backwards", [][3]float32{{0, 0, 0}, {0, 2, 0}, {1, 1, 0}, {2, 2, 0}, {2, 0, 0}}, 3},
+		{"tilted", [][3]float32{{0, 0, 0}, {1, 0, 1}, {1, 1, 1}, {0, 1, 0}}, math.Sqrt2},
+		{"collinear corner", [][3]float32{{0, 0, 0}, {1, 0, 0}, {2, 0, 0}, {2, 1, 0}, {0, 1, 0}}, 2},
+		// Nothing is an ear, so it's fanned rather than dropped.
+		{"degenerate", [][3]float32{{0, 0, 0}, {1, 0, 0}, {2, 0, 0}, {3, 0, 0}}, 0},
+	}
+
+	for _, test := range(tests) {
+		indices := triangulate(test.positions)
+		count := len(test.positions)
+		if count < 3 {
+			if len(indices) != 0 {
+				t.Errorf("%v: expected no triangles, got %v", test.name, indices)
+			}
+			continue
+		}
+		if len(indices) != 3 * (count - 2) {
+			t.Errorf("%v: %v indices, expected %v", test.name, len(indices), 3 * (count - 2))
+			continue
+		}
+
+		normal := polygonNormal(test.positions)
+		area := 0.0
+		for i := 0; i < len(indices); i += 3 {
+			for _, index := range(indices[i:i+3]) {
+				if index < 0 || index >= count {
+					t.Fatalf("%v: index %v out of range", test.name, index)
+				}
+			}
+			n := cross3(test.positions[indices[i]], test.positions[indices[i+1]], test.positions[indices[i+2]])
+			if test.area == 0 {
+				continue
+			}
+			// Every triangle winds the same way as the polygon
+			dot := n[0] * normal[0] + n[1] * normal[1] + n[2] * normal[2]
+			if dot <= 0 {
+				t.Errorf("%v: triangle %v is flipped or degenerate", test.name, indices[i:i+3])
+			}
+			area += math.Sqrt(n[0] * n[0] + n[1] * n[1] + n[2] * n[2]) / 2
+		}
+		// Overlapping triangles would cover more than the polygon does.
+		if test.area != 0 && math.Abs(area - test.area) > 1e-5 {
+			t.Errorf("%v: triangles cover %v, expected %v", test.name, area, test.area)
+		}
+	}
+}
+
+// Newell's method, as triangulate uses.
+func polygonNormal(positions [][3]float32) [3]float64 {
+	var normal [3]float64
+	for i, a := range(positions) {
+		b := positions[(i+1) % len(positions)]
+		normal[0] += float64((a[1] - b[1]) * (a[2] + b[2]))
+		normal[1] += float64((a[2] - b[2]) * (a[0] + b[0]))
+		normal[2] += float64((a[0] - b[0]) * (a[1] + b[1]))
+	}
+	return normal
+}
+
+func cross3(a, b, c [3]float32) [3]float64 {
+	u := [3]float64{float64(b[0] - a[0]), float64(b[1] - a[1]), float64(b[2] - a[2])}
+	v := [3]float64{float64(c[0] - a[0]), float64(c[1] - a[1]), float64(c[2] - a[2])}
+	return [3]float64{
+		u[1] * v[2] - u[2] * v[1],
+		u[2] * v[0] - u[0] * v[2],
+		u[0] * v[1] - u[1] * v[0],
+	}
+}
@@ -1,87 +1,168 @@
 package obj
 
 import (
-	"github.com/fsnotify/fsnotify"
-	"os"
+	"fmt"
+	watch "github.com/crabmusket/lowrezjam2017/watch"
+	"path/filepath"
+	"sync"
 	"time"
 )
 
+// If a reload fails, Err says why and Data is nil. The object keeps what it
+// had before.
 type ObjectUpdate struct {
 	Data *Object
 	Warnings []*Warning
 	Object *Object
+	Err error
 }
 
+// Updates waiting for the main thread. Only the latest update for each object
+// is kept, so saving a file several times in a row only reloads it once.
 var (
-	updates chan *ObjectUpdate
+	updatesLock sync.Mutex
+	updates []*ObjectUpdate
 )
 
-func init() {
-	updates = make(chan *ObjectUpdate, 10)
-}
+func queueUpdate(update *ObjectUpdate) {
+	updatesLock.Lock()
+	defer updatesLock.Unlock()
 
-// You must call this function from the main thread which is running opengl.
-func ProcessUpdates(warn func([]*Warning)) {
-	select {
-	case update := <-updates:
-		// TODO: release buffer
-		update.Object.Indices = make([]uint32, len(update.Data.Indices))
-		update.Object.Vertices = make([]float32, len(update.Data.Vertices))
-		copy(update.Object.Indices, update.Data.Indices)
-		copy(update.Object.Vertices, update.Data.Vertices)
-		update.Object.Unbind()
-		update.Object.Bind()
-		if update.Warnings != nil && len(update.Warnings) > 0 && warn != nil {
-			warn(update.Warnings)
+	for i, pending := range(updates) {
+		if pending.Object == update.Object {
+			updates[i] = update
+			return
 		}
+	}
+	updates = append(updates, update)
+}
 
-	default:
-		// do nothing
+func nextUpdate() *ObjectUpdate {
+	updatesLock.Lock()
+	defer updatesLock.Unlock()
+
+	if len(updates) == 0 {
+		return nil
 	}
+	update := updates[0]
+	updates = updates[1:]
+	return update
 }
 
-func (self *Object) Watch() error {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		return err
+// Apply pending updates until there are none left or budget has been spent,
+// calling report after each one. At least one update is applied each call so
+// reloads can't be starved. You must call this function from the main thread
+// which is running opengl.
+func ProcessUpdates(budget time.Duration, report func(*ObjectUpdate)) {
+	start := time.Now()
+
+	for {
+		update := nextUpdate()
+		if update == nil {
+			return
+		}
+
+		if update.Err == nil && update.Object.Atlas != nil {
+			update.Err = update.Data.UseAtlas(update.Object.Atlas)
+		}
+		if update.Err == nil {
+			update.Object.replaceWith(update.Data)
+		}
+
+		if report != nil {
+			report(update)
+		}
+
+		if time.Since(start) >= budget {
+			return
+		}
 	}
+}
 
-	err = watcher.Add(self.Filename)
-	if err != nil {
-		return err
+// Swap everything about the mesh for a reloaded version of it, all at once so
+// nothing is drawn with a mix of old and new ranges.
+func (self *Object) replaceWith(data *Object) {
+	data.Filename = self.Filename
+	data.options = self.options
+	data.Parts = keepPartState(self.Parts, data.Parts)
+
+	// Release the old buffers before making new ones
+	self.Unbind()
+	*self = *data
+	self.Bind()
+}
+
+// Hidden parts should stay hidden and moved parts should stay put when their
+// geometry is reloaded.
+func keepPartState(old []*Part, parts []*Part) []*Part {
+	for _, part := range(parts) {
+		for _, previous := range(old) {
+			if previous.Object == part.Object && previous.Group == part.Group {
+				part.Hidden = previous.Hidden
+				part.Transform = previous.Transform
+				break
+			}
+		}
 	}
+	return parts
+}
 
-	go func() {
-		for {
-			select {
-			case event := <-watcher.Events:
-				if event.Name == self.Filename {
-					file, err := os.Open(self.Filename)
-					if err != nil {
-						continue
-					}
-					defer file.Close()
-
-					obj, warnings, err := Read(file)
-					if err != nil {
-						continue
-					}
-
-					update := &ObjectUpdate{
-						Data: obj,
-						Warnings: warnings,
-						Object: self,
-					}
-					updates <- update
-				}
-
-			default:
-				// do nothing
+// Reload the object when its file or any of its material libraries change.
+// Libraries which a reload starts using are watched from then on.
+func (self *Object) Watch(watcher *watch.Watcher) error {
+	// The handler runs on the watcher's goroutine while the main thread may be
+	// replacing *self, so it only uses copies of what it needs.
+	filename := self.Filename
+	options := self.options
+	dir := filepath.Dir(filename)
+
+	var watchedLock sync.Mutex
+	watched := make(map[string]bool)
+	var reload watch.Handler
+	watchLibraries := func(libraries []string) error {
+		watchedLock.Lock()
+		defer watchedLock.Unlock()
+
+		for _, library := range(libraries) {
+			path := filepath.Join(dir, filepath.FromSlash(library))
+			if watched[path] {
+				continue
+			}
+			_, err := watcher.Watch(path, reload)
+			if err != nil {
+				return err
 			}
+			watched[path] = true
+		}
+		return nil
+	}
 
-			time.Sleep(100 * time.Millisecond)
+	reload = func(string) {
+		obj, warnings, err := readFile(filename, options)
+		if err == nil {
+			err = obj.Validate()
+		}
+		if err != nil {
+			queueUpdate(&ObjectUpdate{Object: self, Err: err})
+			return
+		}
+
+		err = watchLibraries(obj.MaterialLibraries)
+		if err != nil {
+			fmt.Printf("could not watch the material libraries of %v: %v\n", filename, err)
 		}
-	}()
 
-	return nil
+		update := &ObjectUpdate{
+			Data: obj,
+			Warnings: warnings,
+			Object: self,
+		}
+		queueUpdate(update)
+	}
+
+	_, err := watcher.Watch(filename, reload)
+	if err != nil {
+		return err
+	}
+	return watchLibraries(self.MaterialLibraries)
 }
@@ -0,0 +1,154 @@
+package obj
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Severity int
+
+const (
+	// Nothing is wrong, but something was ignored or made up.
+	SeverityInfo Severity = iota
+	// The mesh loaded, but probably doesn't look the way the artist intended.
+	SeverityWarning
+	// Data was malformed and has been dropped.
+	SeverityError
+)
+
+func (self Severity) String() string {
+	switch self {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", int(self))
+}
+
+// Codes are stable so that tools can filter on them.
+type WarningCode int
+
+const (
+	UnknownWarning WarningCode = iota
+	UnsupportedDirective
+	UnsupportedFeature
+	BadComponentCount
+	BadNumber
+	BadIndex
+	BadStructure
+	MisplacedStatement
+	MissingAttribute
+	MissingMaterial
+	MissingLibrary
+	WriteFailed
+)
+
+var warningCodeNames = []string{
+	"UnknownWarning",
+	"UnsupportedDirective",
+	"UnsupportedFeature",
+	"BadComponentCount",
+	"BadNumber",
+	"BadIndex",
+	"BadStructure",
+	"MisplacedStatement",
+	"MissingAttribute",
+	"MissingMaterial",
+	"MissingLibrary",
+	"WriteFailed",
+}
+
+func (self WarningCode) String() string {
+	if self < 0 || int(self) >= len(warningCodeNames) {
+		return fmt.Sprintf("WarningCode(%d)", int(self))
+	}
+	return warningCodeNames[self]
+}
+
+// Line and Column are 1-based, and 0 when the warning isn't about any one
+// place in the file.
+type Warning struct {
+	Filename string
+	Line int
+	Column int
+	Severity Severity
+	Code WarningCode
+	Warning string
+
+	// Index of the component on the line the warning is about, which the
+	// reader turns into a Column.
+	token int
+}
+
+func (self Warning) String() string {
+	place := self.Filename
+	if self.Line > 0 {
+		if place == "" {
+			place = "line "
+		} else {
+			place += ":"
+		}
+		place += fmt.Sprintf("%d", self.Line)
+		if self.Column > 0 {
+			place += fmt.Sprintf(":%d", self.Column)
+		}
+	}
+	if place != "" {
+		place += ": "
+	}
+	return fmt.Sprintf("%v%v: %v [%v]", place, self.Severity, self.Warning, self.Code)
+}
+
+type Options struct{
+	// Fail to load if there are any warnings with SeverityError.
+	Strict bool
+	// Add a Tangent to every vertex, for normal mapping.
+	Tangents bool
+}
+
+// Returned in strict mode when a mesh has errors in it.
+type StrictError struct{
+	Errors []*Warning
+}
+
+func (self StrictError) Error() string {
+	lines := make([]string, len(self.Errors))
+	for i, warning := range(self.Errors) {
+		lines[i] = warning.String()
+	}
+	return fmt.Sprintf("%d errors:\n%v", len(self.Errors), strings.Join(lines, "\n"))
+}
+
+func (self Options) check(warnings []*Warning) error {
+	if !self.Strict {
+		return nil
+	}
+
+	errors := errorsIn(warnings)
+	if len(errors) > 0 {
+		return &StrictError{Errors: errors}
+	}
+
+	return nil
+}
+
+// Process a mesh which has loaded successfully.
+func (self Options) apply(obj *Object) {
+	if self.Tangents {
+		obj.ComputeTangents()
+	}
+	obj.options = self
+}
+
+func errorsIn(warnings []*Warning) []*Warning {
+	var errors []*Warning
+	for _, warning := range(warnings) {
+		if warning.Severity >= SeverityError {
+			errors = append(errors, warning)
+		}
+	}
+	return errors
+}
@@ -0,0 +1,232 @@
+package obj
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Write an object to filename as Wavefront OBJ. If any of its materials have
+// descriptions, they're written to a .mtl library of the same name alongside.
+func Save(filename string, obj *Object) error {
+	var libraries []string
+	dir := filepath.Dir(filename)
+
+	if hasDescriptions(obj) {
+		base := filepath.Base(filename)
+		libraryName := base[0:len(base)-len(filepath.Ext(base))] + ".mtl"
+		libraries = append(libraries, libraryName)
+
+		err := writeFile(filepath.Join(dir, libraryName), func(writer io.Writer) error {
+			return WriteMaterialLibrary(writer, obj, dir)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeFile(filename, func(writer io.Writer) error {
+		return writeObj(writer, obj, libraries)
+	})
+}
+
+// Write an object as Wavefront OBJ, referencing the material libraries it was
+// read with. Every vertex is written with its own position, texture coordinate
+// and normal, so reading the output back gives the same vertex buffer.
+// Texture coordinates may differ by float rounding since obj flips them. Formats
+// without texture coordinates or normals are written without them, and get
+// the defaults Read fills in when read back.
+func Write(writer io.Writer, obj *Object) error {
+	return writeObj(writer, obj, obj.MaterialLibraries)
+}
+
+func writeObj(writer io.Writer, obj *Object, libraries []string) error {
+	w := bufio.NewWriter(writer)
+	stride := obj.Stride()
+	numVerts := len(obj.Vertices) / stride
+	texCoordOffset := obj.Format.Offset(TextureCoords)
+	normalOffset := obj.Format.Offset(Normal)
+	colourOffset := obj.Format.Offset(Colour)
+
+	fmt.Fprintf(w, "# %v vertices, %v triangles\n", numVerts, len(obj.Indices) / 3)
+	for _, library := range(libraries) {
+		fmt.Fprintf(w, "mtllib %v\n", library)
+	}
+
+	for vert := 0; vert < numVerts; vert += 1 {
+		v := obj.Vertices[vert*stride:]
+		if colourOffset >= 0 {
+			c := v[colourOffset:]
+			fmt.Fprintf(w, "v %v %v %v %v\n", formatFloat(v[0]), formatFloat(v[1]), formatFloat(v[2]), formatColour([3]float32{c[0], c[1], c[2]}))
+		} else {
+			fmt.Fprintf(w, "v %v %v %v\n", formatFloat(v[0]), formatFloat(v[1]), formatFloat(v[2]))
+		}
+	}
+	texCoords, normals := texCoordOffset >= 0, normalOffset >= 0
+	if texCoords {
+		for vert := 0; vert < numVerts; vert += 1 {
+			v := obj.Vertices[vert*stride+texCoordOffset:]
+			fmt.Fprintf(w, "vt %v %v\n", formatFloat(v[0]), formatFloat(1-v[1]))
+		}
+	}
+	if normals {
+		for vert := 0; vert < numVerts; vert += 1 {
+			v := obj.Vertices[vert*stride+normalOffset:]
+			fmt.Fprintf(w, "vn %v %v %v\n", formatFloat(v[0]), formatFloat(v[1]), formatFloat(v[2]))
+		}
+	}
+
+	object := ""
+	// The material in obj.Materials which faces are being written with. A
+	// usemtl carries on across o and g, and a material which does too is
+	// only one range when read back, so it mustn't be repeated.
+	active := -1
+	for i, part := range(obj.Parts) {
+		// Groups belong to the most recent object, so a new o is needed
+		// whenever we leave a group. Faces before the first o or g don't need a
+		// statement of their own.
+		if i == 0 || part.Object != object || part.Group == "" {
+			if i > 0 || part.Object != "" {
+				writeStatement(w, "o", part.Object)
+			}
+		}
+		if part.Group != "" {
+			writeStatement(w, "g", part.Group)
+		}
+		object = part.Object
+
+		// Anything the part's materials don't cover still has to be written,
+		// which can only happen before the file's first usemtl, so it has to
+		// come before this part's first usemtl too.
+		if len(part.Materials) == 0 {
+			writeFaces(w, obj.Indices[part.Start:part.End], texCoords, normals)
+		} else if first := part.Materials[0].Start; first > part.Start {
+			writeFaces(w, obj.Indices[part.Start:first], texCoords, normals)
+		}
+
+		for _, material := range(part.Materials) {
+			if current := obj.materialAt(material.Start); current != active || current < 0 {
+				writeStatement(w, "usemtl", material.Name)
+				active = current
+			}
+			writeFaces(w, obj.Indices[material.Start:material.End], texCoords, normals)
+		}
+	}
+
+	return w.Flush()
+}
+
+// The index of the material whose range includes index, or -1.
+func (self Object) materialAt(index uint32) int {
+	for i, material := range(self.Materials) {
+		if material.Start <= index && index < material.End {
+			return i
+		}
+	}
+	return -1
+}
+
+func writeStatement(w io.Writer, statement string, name string) {
+	if name == "" {
+		fmt.Fprintf(w, "%v\n", statement)
+	} else {
+		fmt.Fprintf(w, "%v %v\n", statement, name)
+	}
+}
+
+// Every vertex has the same index in each list, but a format may not have
+// texture coordinates or normals to refer to.
+func writeFaces(w io.Writer, indices []uint32, texCoords bool, normals bool) {
+	corner := func(index uint32) string {
+		n := strconv.Itoa(int(index) + 1)
+		switch {
+		case texCoords && normals:
+			return n + "/" + n + "/" + n
+		case normals:
+			return n + "//" + n
+		case texCoords:
+			return n + "/" + n
+		}
+		return n
+	}
+	for i := 0; i + 2 < len(indices); i += 3 {
+		fmt.Fprintf(w, "f %v %v %v\n", corner(indices[i]), corner(indices[i+1]), corner(indices[i+2]))
+	}
+}
+
+// Write the descriptions of an object's materials as a .mtl library. Texture
+// paths are written relative to dir, which should be where the library goes.
+func WriteMaterialLibrary(writer io.Writer, obj *Object, dir string) error {
+	w := bufio.NewWriter(writer)
+	written := make(map[string]bool)
+
+	for _, material := range(obj.Materials) {
+		description := material.Description
+		if description == nil || written[material.Name] {
+			continue
+		}
+		written[material.Name] = true
+
+		fmt.Fprintf(w, "newmtl %v\n", material.Name)
+		fmt.Fprintf(w, "Ns %v\n", formatFloat(description.Shininess))
+		fmt.Fprintf(w, "Ka %v\n", formatColour(description.Ambient))
+		fmt.Fprintf(w, "Kd %v\n", formatColour(description.Diffuse))
+		fmt.Fprintf(w, "Ks %v\n", formatColour(description.Specular))
+		fmt.Fprintf(w, "d %v\n", formatFloat(description.Dissolve))
+		fmt.Fprintf(w, "illum %v\n", description.Illumination)
+		if description.DiffuseMap != "" {
+			fmt.Fprintf(w, "map_Kd %v\n", relativePath(dir, description.DiffuseMap))
+		}
+		if description.BumpMap != "" {
+			fmt.Fprintf(w, "map_Bump %v\n", relativePath(dir, description.BumpMap))
+		}
+		fmt.Fprintf(w, "\n")
+	}
+
+	return w.Flush()
+}
+
+func hasDescriptions(obj *Object) bool {
+	for _, material := range(obj.Materials) {
+		if material.Description != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func writeFile(filename string, write func(io.Writer) error) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	err = write(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func relativePath(dir string, filename string) string {
+	relative, err := filepath.Rel(dir, filename)
+	if err != nil {
+		relative = filename
+	}
+	return filepath.ToSlash(relative)
+}
+
+// The shortest representation that reads back as exactly the same float32.
+func formatFloat(value float32) string {
+	return strconv.FormatFloat(float64(value), 'f', -1, 32)
+}
+
+func formatColour(colour [3]float32) string {
+	return strings.Join([]string{formatFloat(colour[0]), formatFloat(colour[1]), formatFloat(colour[2])}, " ")
+}
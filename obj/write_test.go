@@ -0,0 +1,233 @@
+package obj
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"strings"
+	"testing"
+)
+
+var roundTripSources = map[string]string{
+	"single triangle": `
+v 0 0 0
+v 1 0 0
+v 0 1 0
+vt 0 0
+vt 1 0
+vt 0 1
+vn 0 0 1
+f 1/1/1 2/2/1 3/3/1
+`,
+	"faces before the first usemtl": `
+v 0 0 0
+v 1 0 0
+v 0 1 0
+v 1 1 0
+vt 0 0
+vt 1 0
+vt 0 1
+vt 1 1
+vn 0 0 1
+f 1/1/1 2/2/1 3/3/1
+usemtl a
+f 2/2/1 4/4/1 3/3/1
+usemtl b
+f 1/1/1 4/4/1 3/3/1
+`,
+	"objects and groups": `
+v 0 0 0
+v 1 0 0
+v 0 1 0
+v 1 1 0 0.5 0.25 1
+vt 0 0
+vt 1 0
+vt 0 1
+vt 1 1
+vn 0 0 1
+f 1/1/1 2/2/1 3/3/1
+o first
+usemtl a
+f 2/2/1 4/4/1 3/3/1
+g inner
+f 1/1/1 2/2/1 4/4/1
+o second
+usemtl b
+f 1/1/1 4/4/1 3/3/1
+usemtl a
+f 3/3/1 4/4/1 2/2/1
+`,
+	"polygon": `
+v 0 0 0
+v 2 0 0
+v 2 2 0
+v 1 1 0
+v 0 2 0
+f 1 2 3 4 5
+`,
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	sources := make(map[string]string)
+	for name, source := range(roundTripSources) {
+		sources[name] = source
+	}
+	level, err := ioutil.ReadFile("../resources/meshes/floor1.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources["floor1.obj"] = string(level)
+
+	for name, source := range(sources) {
+		original, _, err := Read(strings.NewReader(source))
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+
+		var buffer bytes.Buffer
+		err = Write(&buffer, original)
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+
+		written, _, err := Read(&buffer)
+		if err != nil {
+			t.Fatalf("%v: reading written object: %v", name, err)
+		}
+
+		if !formatsEqual(original.Format, written.Format) {
+			t.Errorf("%v: format %v became %v", name, original.Format, written.Format)
+		}
+		if !verticesClose(original.Vertices, written.Vertices) {
+			t.Errorf("%v: vertices %v became %v", name, original.Vertices, written.Vertices)
+		}
+		if !indicesEqual(original.Indices, written.Indices) {
+			t.Errorf("%v: indices %v became %v", name, original.Indices, written.Indices)
+		}
+		if !materialsEqual(original.Materials, written.Materials) {
+			t.Errorf("%v: materials %v became %v", name, original.Materials, written.Materials)
+		}
+		if len(original.Parts) != len(written.Parts) {
+			t.Fatalf("%v: %v parts became %v", name, len(original.Parts), len(written.Parts))
+		}
+		for i, part := range(original.Parts) {
+			other := written.Parts[i]
+			if part.Name() != other.Name() || part.Start != other.Start || part.End != other.End {
+				t.Errorf("%v: part %v %v-%v became %v %v-%v", name, part.Name(), part.Start, part.End, other.Name(), other.Start, other.End)
+			}
+			if !materialsEqual(part.Materials, other.Materials) {
+				t.Errorf("%v: part %v materials %v became %v", name, part.Name(), part.Materials, other.Materials)
+			}
+		}
+	}
+}
+
+func formatsEqual(a, b VertexFormat) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range(a) {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Texture coordinates are flipped on the way in and out, so they're allowed
+// to be off by rounding.
+func verticesClose(a, b []float32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range(a) {
+		if math.Abs(float64(a[i] - b[i])) > 1e-6 {
+			return false
+		}
+	}
+	return true
+}
+
+func indicesEqual(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range(a) {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func materialsEqual(a, b []Material) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range(a) {
+		if a[i].Name != b[i].Name || a[i].Start != b[i].Start || a[i].End != b[i].End {
+			return false
+		}
+	}
+	return true
+}
+
+// Formats without texture coordinates or normals, as Merge allows, are written
+// with faces which don't refer to them.
+func TestWriteFormats(t *testing.T) {
+	positions := []float32{0, 0, 0, 1, 0, 0, 1, 1, 0, 0, 1, 0}
+	tests := []struct{
+		name string
+		format VertexFormat
+		face string
+	}{
+		{"everything", VertexFormat{Position, Normal, TextureCoords}, "f 1/1/1 2/2/2 3/3/3\n"},
+		{"no texture coordinates", VertexFormat{Position, Normal}, "f 1//1 2//2 3//3\n"},
+		{"no normals", VertexFormat{Position, TextureCoords}, "f 1/1 2/2 3/3\n"},
+		{"positions only", VertexFormat{Position}, "f 1 2 3\n"},
+	}
+
+	for _, test := range(tests) {
+		original := &Object{Format: test.format}
+		for i := 0; i < len(positions); i += 3 {
+			vertex := make([]float32, test.format.Stride())
+			copy(vertex, positions[i:i+3])
+			original.Vertices = append(original.Vertices, vertex...)
+		}
+		original.Indices = []uint32{0, 1, 2, 0, 2, 3}
+		original.Parts = []*Part{&Part{Start: 0, End: 6}}
+
+		var buffer bytes.Buffer
+		err := Write(&buffer, original)
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		text := buffer.String()
+		if !strings.Contains(text, test.face) {
+			t.Errorf("%v: expected a face %q in:\n%v", test.name, test.face, text)
+		}
+		if strings.Contains(text, "vt ") != test.format.Has(TextureCoords) || strings.Contains(text, "vn ") != test.format.Has(Normal) {
+			t.Errorf("%v: wrote the wrong lists for its format:\n%v", test.name, text)
+		}
+
+		written, _, err := Read(&buffer)
+		if err != nil {
+			t.Fatalf("%v: reading written object: %v", test.name, err)
+		}
+		// Missing normals are filled in flat for each face, which splits the
+		// vertices the two triangles share, so compare the faces' corners
+		// rather than the vertex buffers.
+		if len(written.Indices) != len(original.Indices) {
+			t.Errorf("%v: indices %v became %v", test.name, original.Indices, written.Indices)
+			continue
+		}
+		stride := written.Stride()
+		for i, index := range(written.Indices) {
+			p := written.Vertices[int(index)*stride+written.Format.Offset(Position):]
+			vert := original.Indices[i]
+			if !verticesClose(p[:3], positions[vert*3:vert*3+3]) {
+				t.Errorf("%v: corner %v moved to %v", test.name, i, p[:3])
+			}
+		}
+	}
+}
@@ -5,8 +5,15 @@ in vec2 vertTexCoord;
 out vec4 colour;
 
 uniform sampler2D screenTexture;
+uniform bool broken = false;
 
 void main()
 { 
     colour = texture(screenTexture, vertTexCoord);
+
+    // A shader failed to reload, so draw a red border around the screen
+    vec2 edge = min(vertTexCoord, 1 - vertTexCoord);
+    if (broken && min(edge.x, edge.y) < 0.02) {
+        colour = vec4(1, 0, 0, 1);
+    }
 }
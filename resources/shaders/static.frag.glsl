@@ -3,7 +3,10 @@
 in vec3 vertPos;
 in vec3 vertNormal;
 in vec2 vertTexCoord;
+in vec4 vertTangent;
 in float vertDist;
+in vec3 vertColour;
+flat in vec4 vertAtlasRect;
 
 out vec4 fragColour;
 
@@ -15,6 +18,8 @@ struct PointLight {
 };
 
 uniform sampler2D textureMap;
+uniform sampler2D normalMap;
+uniform bool useAtlas = false;
 uniform vec3 cameraPos;
 uniform float ambient;
 uniform vec3 fogColour = vec3(0, 0, 0);
@@ -25,7 +30,15 @@ uniform PointLight pointLights[POINT_LIGHT_COUNT];
 vec3 handlePointLight(PointLight light, vec3 pos, vec3 normal, vec3 viewDir);
 
 void main() {
+	// The normal map is in tangent space, see obj.ComputeTangents
 	vec3 normal = normalize(vertNormal);
+	vec3 tangent = vertTangent.xyz - normal * dot(normal, vertTangent.xyz);
+	if (length(tangent) > 0.001) {
+		tangent = normalize(tangent);
+		vec3 bitangent = cross(normal, tangent) * vertTangent.w;
+		vec3 mapped = texture(normalMap, vertTexCoord).xyz * 2 - 1;
+		normal = normalize(mat3(tangent, bitangent, normal) * mapped);
+	}
 	vec3 viewDir = normalize(cameraPos - vertPos);
 
 	vec3 light = vec3(ambient, ambient, ambient);
@@ -35,7 +48,20 @@ void main() {
 
 	float fog = clamp((fogEnd - vertDist) / (fogEnd - fogStart), 0,  1);
 
-	vec4 textureColour = texture(textureMap, vertTexCoord);
+	vec4 textureColour;
+	if (useAtlas) {
+		// Wrap into this texture's rectangle of the atlas ourselves, since the
+		// sampler would wrap around the whole atlas. The gradients come from the
+		// unwrapped coordinates so mipmapping doesn't jump at the seams.
+		vec2 atlasCoord = vertAtlasRect.xy + fract(vertTexCoord) * vertAtlasRect.zw;
+		vec2 dx = dFdx(vertTexCoord) * vertAtlasRect.zw;
+		vec2 dy = dFdy(vertTexCoord) * vertAtlasRect.zw;
+		textureColour = textureGrad(textureMap, atlasCoord, dx, dy);
+	} else {
+		// Separate textures wrap however their settings say.
+		textureColour = texture(textureMap, vertTexCoord);
+	}
+	textureColour *= vec4(vertColour, 1);
 	fragColour = mix(vec4(fogColour, 1), vec4(light, 1) * textureColour, fog);
 }
 
@@ -3,11 +3,17 @@
 in vec3 pos;
 in vec3 norm;
 in vec2 tex;
+in vec4 tangent;
+in vec3 colour;
+in vec4 atlasRect;
 
 out vec3 vertPos;
 out vec3 vertNormal;
 out vec2 vertTexCoord;
+out vec4 vertTangent;
 out float vertDist;
+out vec3 vertColour;
+flat out vec4 vertAtlasRect;
 
 uniform mat4 model;
 uniform mat4 view;
@@ -17,7 +23,10 @@ uniform vec3 cameraPos;
 void main() {
 	gl_Position = projection * view * model * vec4(pos, 1);
 	vertPos = (model * vec4(pos, 1)).xyz;
-	vertNormal = (model * vec4(norm, 1)).xyz;
+	vertNormal = (model * vec4(norm, 0)).xyz;
+	vertTangent = vec4((model * vec4(tangent.xyz, 0)).xyz, tangent.w);
 	vertTexCoord = tex;
+	vertColour = colour;
+	vertAtlasRect = atlasRect;
 	vertDist = length(model * vec4(pos, 1) - vec4(cameraPos, 1));
 }
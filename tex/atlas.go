@@ -0,0 +1,206 @@
+package textures
+
+import (
+	"fmt"
+	watch "github.com/crabmusket/lowrezjam2017/watch"
+	"github.com/go-gl/gl/v3.2-core/gl"
+	"image"
+	"sort"
+)
+
+// Where an image is in an atlas, in texture coordinates with the top row of
+// the image at Y.
+type Rect struct{
+	X float32
+	Y float32
+	Width float32
+	Height float32
+}
+
+// Several images packed into one texture, so that meshes using any of them can
+// be drawn without switching textures. Entries are keyed like a Library.
+type Atlas struct{
+	Texture *Texture
+	Entries map[string]Rect
+	Size image.Point
+	Padding int
+
+	filenames []string
+	// Where each image's top left pixel is, in the same order as filenames.
+	positions []image.Point
+	sizes []image.Point
+}
+
+// Pack images into an atlas, with padding pixels around each one. Images are
+// meant to tile, so the padding is filled by wrapping each image around
+// rather than with empty space, which keeps filtering from picking up colours
+// from the neighbouring images.
+func BuildAtlas(filenames []string, padding int) (*Atlas, error) {
+	atlas := &Atlas{
+		Entries: make(map[string]Rect),
+		Padding: padding,
+		filenames: filenames,
+	}
+
+	images := make([]*image.RGBA, len(filenames))
+	for i, filename := range(filenames) {
+		key := Key(filename)
+		if _, ok := atlas.Entries[key]; ok {
+			return nil, fmt.Errorf("atlas has two images called %v", key)
+		}
+		atlas.Entries[key] = Rect{}
+
+		img, err := loadAtlasImage(filename)
+		if err != nil {
+			return nil, err
+		}
+		if img.Rect.Empty() {
+			return nil, fmt.Errorf("%v is empty", filename)
+		}
+		images[i] = img
+		atlas.sizes = append(atlas.sizes, img.Rect.Size())
+	}
+
+	atlas.pack()
+
+	for i, filename := range(filenames) {
+		position, size := atlas.positions[i], atlas.sizes[i]
+		atlas.Entries[Key(filename)] = Rect{
+			X: float32(position.X) / float32(atlas.Size.X),
+			Y: float32(position.Y) / float32(atlas.Size.Y),
+			Width: float32(size.X) / float32(atlas.Size.X),
+			Height: float32(size.Y) / float32(atlas.Size.Y),
+		}
+	}
+
+	pixels := atlas.compose(images)
+	atlas.Texture = &Texture{Filename: fmt.Sprintf("atlas of %v images", len(filenames))}
+	atlas.Texture.Bind(pixels.Pix, &atlas.Size)
+
+	// Smaller mipmap levels would blur images into each other once the padding
+	// shrinks to nothing, so stop before then.
+	levels := int32(0)
+	for p := padding; p > 1; p /= 2 {
+		levels += 1
+	}
+	gl.BindTexture(gl.TEXTURE_2D, atlas.Texture.Id)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAX_LEVEL, levels)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+
+	return atlas, nil
+}
+
+// Shelf packing: place images tallest first in rows across an atlas whose
+// width is a power of two, then make the height a power of two that fits.
+func (self *Atlas) pack() {
+	order := make([]int, len(self.sizes))
+	area := 0
+	widest := 0
+	for i, size := range(self.sizes) {
+		order[i] = i
+		padded := size.Add(image.Pt(self.Padding * 2, self.Padding * 2))
+		area += padded.X * padded.Y
+		if padded.X > widest {
+			widest = padded.X
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return self.sizes[order[a]].Y > self.sizes[order[b]].Y
+	})
+
+	width := 1
+	for width < widest || width * width < area {
+		width *= 2
+	}
+
+	self.positions = make([]image.Point, len(self.sizes))
+	x, y, shelf := 0, 0, 0
+	for _, i := range(order) {
+		padded := self.sizes[i].Add(image.Pt(self.Padding * 2, self.Padding * 2))
+		if x + padded.X > width {
+			x = 0
+			y += shelf
+			shelf = 0
+		}
+		self.positions[i] = image.Pt(x + self.Padding, y + self.Padding)
+		x += padded.X
+		if padded.Y > shelf {
+			shelf = padded.Y
+		}
+	}
+
+	height := 1
+	for height < y + shelf {
+		height *= 2
+	}
+	self.Size = image.Pt(width, height)
+}
+
+// Images in an atlas are quantized by their own settings, though the rest of
+// their settings are up to the atlas.
+func loadAtlasImage(filename string) (*image.RGBA, error) {
+	settings, err := LoadSettings(filename)
+	if err != nil {
+		return nil, err
+	}
+	img, err := loadRGBA(filename)
+	if err != nil {
+		return nil, err
+	}
+	quantize(filename, img, settings)
+	return img, nil
+}
+
+func (self *Atlas) compose(images []*image.RGBA) *image.RGBA {
+	pixels := image.NewRGBA(image.Rect(0, 0, self.Size.X, self.Size.Y))
+
+	for i, img := range(images) {
+		position, size := self.positions[i], self.sizes[i]
+		p := self.Padding
+		for dy := -p; dy < size.Y + p; dy += 1 {
+			for dx := -p; dx < size.X + p; dx += 1 {
+				sx := ((dx % size.X) + size.X) % size.X
+				sy := ((dy % size.Y) + size.Y) % size.Y
+				pixels.SetRGBA(position.X + dx, position.Y + dy, img.RGBAAt(sx, sy))
+			}
+		}
+	}
+
+	return pixels
+}
+
+// Rebuild the atlas when any of its images change. Images have to keep their
+// size, since meshes already point at where they are in the atlas.
+func (self *Atlas) Watch(watcher *watch.Watcher) error {
+	reload := func(string) {
+		images := make([]*image.RGBA, len(self.filenames))
+		for i, filename := range(self.filenames) {
+			img, err := loadAtlasImage(filename)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			if img.Rect.Size() != self.sizes[i] {
+				fmt.Printf("%v changed size, so the atlas can't be rebuilt without reloading\n", filename)
+				return
+			}
+			images[i] = img
+		}
+
+		pixels := self.compose(images)
+		queueUpdate(&TextureUpdate{
+			Data: pixels.Pix,
+			Size: &self.Size,
+			Texture: self.Texture,
+		})
+	}
+
+	for _, filename := range(self.filenames) {
+		_, err := watchAll(watcher, reload, filename, SourceFilename(filename))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
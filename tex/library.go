@@ -1,7 +1,170 @@
 package textures
 
-type Library map[string]*Texture
+import (
+	"fmt"
+	watch "github.com/crabmusket/lowrezjam2017/watch"
+	"image"
+	"path/filepath"
+	"strings"
+)
 
-func MakeLibrary() Library {
-	return make(Library)
+// Textures shared by everything which draws with them. Each one is loaded
+// once, and deleted when the last thing using it releases it.
+type Library struct{
+	// Textures are watched for changes while they're loaded, unless this is nil.
+	Watcher *watch.Watcher
+
+	entries map[string]*libraryEntry
+	// Keys which have been asked for but weren't loaded, so each one is only
+	// reported once.
+	missing map[string]bool
+	placeholder *Texture
+	flatNormal *Texture
+}
+
+type libraryEntry struct{
+	texture *Texture
+	references int
+}
+
+func MakeLibrary(watcher *watch.Watcher) *Library {
+	return &Library{
+		Watcher: watcher,
+		entries: make(map[string]*libraryEntry),
+		missing: make(map[string]bool),
+	}
+}
+
+// Textures are keyed by their path without its extension, like
+// "resources/textures/wall_stone", so that images with the same name in
+// different folders don't collide.
+func Key(filename string) string {
+	path := filepath.ToSlash(filepath.Clean(filename))
+	return strings.TrimSuffix(path, filepath.Ext(path))
+}
+
+// Load a texture, or take another reference to it if it's already loaded.
+// Every call should be matched by a call to Release.
+func (self *Library) Load(filename string) (*Texture, error) {
+	key := Key(filename)
+	if entry, ok := self.entries[key]; ok {
+		if filepath.Clean(entry.texture.Filename) != filepath.Clean(filename) {
+			return nil, fmt.Errorf("%v and %v would both be texture %v", entry.texture.Filename, filename, key)
+		}
+		entry.references += 1
+		return entry.texture, nil
+	}
+
+	texture, err := Load(filename)
+	if err != nil {
+		return nil, err
+	}
+	if self.Watcher != nil {
+		err := texture.Watch(self.Watcher)
+		if err != nil {
+			texture.Unwatch(self.Watcher)
+			texture.Unbind()
+			return nil, err
+		}
+	}
+
+	self.entries[key] = &libraryEntry{
+		texture: texture,
+		references: 1,
+	}
+	delete(self.missing, key)
+	return texture, nil
+}
+
+// The texture with a key, or a checkerboard if it isn't loaded so that missing
+// textures stand out instead of drawing with whatever was bound last.
+func (self *Library) Get(key string) *Texture {
+	if entry, ok := self.entries[key]; ok {
+		return entry.texture
+	}
+
+	if !self.missing[key] {
+		self.missing[key] = true
+		fmt.Printf("texture %v isn't loaded, using a placeholder\n", key)
+	}
+	return self.Placeholder()
+}
+
+// Give up a reference to a texture. The last one deletes it.
+func (self *Library) Release(key string) {
+	entry, ok := self.entries[key]
+	if !ok {
+		return
+	}
+
+	entry.references -= 1
+	if entry.references > 0 {
+		return
+	}
+
+	if self.Watcher != nil {
+		entry.texture.Unwatch(self.Watcher)
+	}
+	release(entry.texture)
+	entry.texture.Unbind()
+	delete(self.entries, key)
+}
+
+// How many references there are to a texture, which is 0 if it isn't loaded.
+func (self *Library) References(key string) int {
+	if entry, ok := self.entries[key]; ok {
+		return entry.references
+	}
+	return 0
+}
+
+// Magenta and black squares, drawn in place of textures which aren't loaded.
+func (self *Library) Placeholder() *Texture {
+	if self.placeholder != nil {
+		return self.placeholder
+	}
+
+	const size = 8
+	pixels := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y += 1 {
+		for x := 0; x < size; x += 1 {
+			i := pixels.PixOffset(x, y)
+			if (x < size / 2) != (y < size / 2) {
+				copy(pixels.Pix[i:], []uint8{255, 0, 255, 255})
+			} else {
+				copy(pixels.Pix[i:], []uint8{0, 0, 0, 255})
+			}
+		}
+	}
+
+	self.placeholder = &Texture{
+		Filename: "placeholder",
+		Settings: DefaultSettings,
+	}
+	self.placeholder.Settings.Filter = "nearest"
+	self.placeholder.Settings.Mipmaps = false
+	self.placeholder.Bind(pixels.Pix, &pixels.Rect.Max)
+
+	return self.placeholder
+}
+
+// A normal map which leaves normals as they are, for materials without one.
+func (self *Library) FlatNormal() *Texture {
+	if self.flatNormal != nil {
+		return self.flatNormal
+	}
+
+	pixels := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	copy(pixels.Pix, []uint8{128, 128, 255, 255})
+
+	self.flatNormal = &Texture{
+		Filename: "flat normal",
+		Settings: DefaultSettings,
+	}
+	self.flatNormal.Settings.Filter = "nearest"
+	self.flatNormal.Settings.Mipmaps = false
+	self.flatNormal.Settings.ColourSpace = "linear"
+	self.flatNormal.Bind(pixels.Pix, &pixels.Rect.Max)
+
+	return self.flatNormal
 }
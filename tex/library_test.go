@@ -0,0 +1,98 @@
+package textures
+
+import (
+	"testing"
+)
+
+func TestKey(t *testing.T) {
+	tests := []struct{
+		filename string
+		key string
+	}{
+		{"resources/textures/wall_stone.png", "resources/textures/wall_stone"},
+		{"resources/textures/wall_stone.xcf", "resources/textures/wall_stone"},
+		{"resources/meshes/../textures/wall_stone.png", "resources/textures/wall_stone"},
+		{"./wall_stone.png", "wall_stone"},
+		{"wall_stone", "wall_stone"},
+		{"resources/textures/wall.stone.png", "resources/textures/wall.stone"},
+	}
+
+	for _, test := range(tests) {
+		if key := Key(test.filename); key != test.key {
+			t.Errorf("%v: got key %v, expected %v", test.filename, key, test.key)
+		}
+	}
+}
+
+// A library holding a texture which is already loaded, so nothing needs
+// uploading.
+func libraryWith(filename string) (*Library, *Texture) {
+	library := MakeLibrary(nil)
+	texture := &Texture{Filename: filename}
+	library.entries[Key(filename)] = &libraryEntry{
+		texture: texture,
+		references: 1,
+	}
+	return library, texture
+}
+
+func TestLibraryReferences(t *testing.T) {
+	library, texture := libraryWith("resources/textures/wall_stone.png")
+	key := "resources/textures/wall_stone"
+
+	loaded, err := library.Load("resources/meshes/../textures/wall_stone.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded != texture {
+		t.Errorf("loading the same file again gave a different texture")
+	}
+	if references := library.References(key); references != 2 {
+		t.Errorf("%v references, expected 2", references)
+	}
+	if library.Get(key) != texture {
+		t.Errorf("Get gave a different texture")
+	}
+
+	library.Release(key)
+	if references := library.References(key); references != 1 {
+		t.Errorf("%v references after a release, expected 1", references)
+	}
+	// Releasing something which isn't loaded does nothing
+	library.Release("resources/textures/missing")
+	if references := library.References("resources/textures/missing"); references != 0 {
+		t.Errorf("%v references to a missing texture", references)
+	}
+}
+
+func TestLibraryCollision(t *testing.T) {
+	library, _ := libraryWith("resources/textures/wall_stone.png")
+
+	_, err := library.Load("resources/textures/wall_stone.jpg")
+	if err == nil {
+		t.Errorf("two files with the same key should be an error")
+	}
+	if references := library.References("resources/textures/wall_stone"); references != 1 {
+		t.Errorf("%v references after a collision, expected 1", references)
+	}
+}
+
+// A reload which finishes after its texture was released mustn't queue an
+// upload to it.
+func TestReleasedUpdates(t *testing.T) {
+	kept := &Texture{Filename: "kept.png"}
+	released := &Texture{Filename: "released.png"}
+
+	queueUpdate(&TextureUpdate{Texture: kept})
+	queueUpdate(&TextureUpdate{Texture: released})
+	release(released)
+	queueUpdate(&TextureUpdate{Texture: released})
+
+	var textures []*Texture
+	for update := nextUpdate(); update != nil; update = nextUpdate() {
+		textures = append(textures, update.Texture)
+	}
+	if len(textures) != 1 || textures[0] != kept {
+		t.Errorf("expected only the kept texture to be updated, got %v", textures)
+	}
+}
@@ -1,6 +1,7 @@
 package textures
 
 import (
+	"github.com/crabmusket/lowrezjam2017/watch"
 	"github.com/go-gl/gl/v3.2-core/gl"
 	"image"
 	"image/draw"
@@ -8,66 +9,126 @@ import (
 	_ "image/jpeg"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 type Texture struct {
 	Id uint32
 	Filename string
+	Settings Settings
+
+	// Set once a Library has deleted the texture, guarded by updatesLock.
+	released bool
+	// What Watch asked the watcher for, so Unwatch can leave other handlers
+	// on the same files alone.
+	watches []watch.Handle
 }
 
-func Load(filename string, library Library) (*Texture, error) {
-	data, size, err := loadImage(filename)
+// Load a texture on its own. Use a Library to share textures between the
+// things drawn with them.
+func Load(filename string) (*Texture, error) {
+	settings, err := LoadSettings(filename)
+	if err != nil {
+		return nil, err
+	}
+	data, size, err := loadImage(filename, settings)
 	if err != nil {
 		return nil, err
 	}
 
 	texture := &Texture{
 		Filename: filename,
+		Settings: settings,
 	}
 	texture.Bind(data, size)
 
-	if library != nil {
-		textureName := filepath.Base(filename)
-		extension := filepath.Ext(filename)
-		textureKey := textureName[0:len(textureName)-len(extension)]
-		library[textureKey] = texture
-	}
-
 	return texture, nil
 }
 
+// Upload an image to the texture using its Settings. A zero Settings is taken
+// to mean DefaultSettings.
 func (self *Texture) Bind(data []byte, size *image.Point) {
 	tex := self.Id
 	if tex == 0 {
 		gl.GenTextures(1, &tex)
 	}
+	if self.Settings == (Settings{}) {
+		self.Settings = DefaultSettings
+	}
 
 	gl.BindTexture(gl.TEXTURE_2D, tex)
-	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.SRGB_ALPHA, int32(size.X), int32(size.Y), 0, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(data))
-	gl.GenerateMipmap(gl.TEXTURE_2D)
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.REPEAT);
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.REPEAT);
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR_MIPMAP_LINEAR);
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR);
+	gl.TexImage2D(gl.TEXTURE_2D, 0, colourSpaces[self.Settings.ColourSpace], int32(size.X), int32(size.Y), 0, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(data))
+	if self.Settings.Mipmaps {
+		gl.GenerateMipmap(gl.TEXTURE_2D)
+	}
+	self.Settings.apply()
 
 	gl.BindTexture(gl.TEXTURE_2D, 0)
 	self.Id = tex
 }
 
-func loadImage(filename string) ([]byte, *image.Point, error) {
-	file, err := os.Open(filename)
+func (self *Texture) Unbind() {
+	gl.DeleteTextures(1, &self.Id)
+	self.Id = 0
+}
+
+func loadImage(filename string, settings Settings) ([]byte, *image.Point, error) {
+	rgba, err := loadRGBA(filename)
 	if err != nil {
 		return nil, nil, err
 	}
+	quantize(filename, rgba, settings)
+
+	size := rgba.Rect.Size()
+	return rgba.Pix, &size, nil
+}
+
+// Apply DefaultQuantizer to an image, if there is one and settings allow it.
+func quantize(filename string, img *image.RGBA, settings Settings) {
+	if DefaultQuantizer == nil || !settings.Quantize {
+		return
+	}
+	report := DefaultQuantizer.Quantize(img)
+	if DefaultQuantizer.Report != nil {
+		DefaultQuantizer.Report(filename, report)
+	}
+}
+
+// Images can be exported from a GIMP file next to them with the same name.
+func SourceFilename(filename string) string {
+	return strings.TrimSuffix(filename, filepath.Ext(filename)) + ".xcf"
+}
+
+// The GIMP source of an image if it's been saved more recently than the image,
+// so artists don't have to remember to export.
+func newestFilename(filename string) string {
+	source := SourceFilename(filename)
+	sourceInfo, err := os.Stat(source)
+	if err != nil {
+		return filename
+	}
+	imageInfo, err := os.Stat(filename)
+	if err != nil || sourceInfo.ModTime().After(imageInfo.ModTime()) {
+		return source
+	}
+	return filename
+}
+
+func loadRGBA(filename string) (*image.RGBA, error) {
+	file, err := os.Open(newestFilename(filename))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
 
 	img, _, err := image.Decode(file)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	rgba := image.NewRGBA(img.Bounds())
-	draw.Draw(rgba, rgba.Bounds(), img, image.ZP, draw.Src)
-	size := rgba.Rect.Size()
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
 
-	return rgba.Pix, &size, nil
+	return rgba, nil
 }
@@ -0,0 +1,321 @@
+package textures
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// A limited set of colours which textures are made to use.
+type Palette []color.RGBA
+
+// How to spread the error when a colour is replaced by the nearest one in a
+// palette, so gradients don't turn into flat bands.
+type Dither int
+
+const (
+	DitherNone Dither = iota
+	// A 4x4 Bayer matrix, which gives a regular crosshatch.
+	DitherOrdered
+	// Error diffusion, which looks more natural but shimmers more when an
+	// image is edited.
+	DitherFloydSteinberg
+)
+
+var DitherNames = map[string]Dither{
+	"none": DitherNone,
+	"ordered": DitherOrdered,
+	"floyd-steinberg": DitherFloydSteinberg,
+}
+
+// Quantizes every texture as it's loaded, if it isn't nil, unless the
+// texture's Settings turn it off.
+var DefaultQuantizer *Quantizer
+
+type Quantizer struct{
+	Palette Palette
+	Dither Dither
+	// Called with how much of each texture changed, if it isn't nil. Textures
+	// are reloaded on the watcher's goroutine, so it has to be safe to call
+	// from there.
+	Report func(filename string, report QuantizeReport)
+}
+
+type QuantizeReport struct{
+	// Pixels which weren't fully transparent.
+	Pixels int
+	// Pixels whose colour changed.
+	Remapped int
+}
+
+func (self QuantizeReport) String() string {
+	percent := 0.0
+	if self.Pixels > 0 {
+		percent = 100 * float64(self.Remapped) / float64(self.Pixels)
+	}
+	return fmt.Sprintf("%v of %v pixels remapped to the palette (%.1f%%)", self.Remapped, self.Pixels, percent)
+}
+
+// Read a palette from a GIMP .gpl file, a .hex file with one RRGGBB colour per
+// line, or any image, whose distinct colours make up the palette.
+func LoadPalette(filename string) (Palette, error) {
+	var palette Palette
+	var err error
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".gpl":
+		palette, err = loadPaletteLines(filename, parseGPLLine)
+	case ".hex":
+		palette, err = loadPaletteLines(filename, parseHexLine)
+	default:
+		palette, err = loadPaletteImage(filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(palette) == 0 {
+		return nil, fmt.Errorf("%v has no colours in it", filename)
+	}
+	return palette, nil
+}
+
+func loadPaletteLines(filename string, parse func(line string, number int) (*color.RGBA, error)) (Palette, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var palette Palette
+	scanner := bufio.NewScanner(file)
+	number := 0
+	for scanner.Scan() {
+		number += 1
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		colour, err := parse(line, number)
+		if err != nil {
+			return nil, fmt.Errorf("%v:%v: %v", filename, number, err)
+		}
+		if colour != nil {
+			palette = append(palette, *colour)
+		}
+	}
+
+	return palette, scanner.Err()
+}
+
+// GIMP palettes start with a header and a few settings like "Columns: 8", then
+// list one colour per line as decimal components followed by its name.
+func parseGPLLine(line string, number int) (*color.RGBA, error) {
+	if number == 1 {
+		if line != "GIMP Palette" {
+			return nil, fmt.Errorf("not a GIMP palette")
+		}
+		return nil, nil
+	}
+	if strings.HasPrefix(line, "#") || strings.Contains(line, ":") {
+		return nil, nil
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("expected red, green and blue, got %q", line)
+	}
+	var components [3]uint8
+	for i := range(components) {
+		value, err := strconv.ParseUint(fields[i], 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("bad colour component %q", fields[i])
+		}
+		components[i] = uint8(value)
+	}
+	return &color.RGBA{components[0], components[1], components[2], 255}, nil
+}
+
+func parseHexLine(line string, number int) (*color.RGBA, error) {
+	hex := strings.TrimPrefix(line, "#")
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 6 {
+		return nil, fmt.Errorf("expected a colour like ff8000, got %q", line)
+	}
+	return &color.RGBA{uint8(value >> 16), uint8(value >> 8), uint8(value), 255}, nil
+}
+
+// Swatch images usually have big blocks of each colour, so only distinct
+// colours are kept, in the order they first appear.
+func loadPaletteImage(filename string) (Palette, error) {
+	img, err := loadRGBA(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	const maxColours = 256
+	var palette Palette
+	seen := make(map[color.RGBA]bool)
+	for i := 0; i < len(img.Pix); i += 4 {
+		if img.Pix[i+3] != 255 {
+			continue
+		}
+		colour := color.RGBA{img.Pix[i], img.Pix[i+1], img.Pix[i+2], 255}
+		if seen[colour] {
+			continue
+		}
+		seen[colour] = true
+		palette = append(palette, colour)
+		if len(palette) > maxColours {
+			return nil, fmt.Errorf("%v has more than %v colours, so it probably isn't a palette", filename, maxColours)
+		}
+	}
+	return palette, nil
+}
+
+// The index of the colour closest to r, g, b.
+func (self Palette) nearest(r, g, b float32) int {
+	best := 0
+	bestDistance := float32(math.Inf(1))
+	for i, colour := range(self) {
+		dr := r - float32(colour.R)
+		dg := g - float32(colour.G)
+		db := b - float32(colour.B)
+		distance := dr * dr + dg * dg + db * db
+		if distance < bestDistance {
+			best, bestDistance = i, distance
+		}
+	}
+	return best
+}
+
+// The average distance from each colour to the closest other one, which is
+// about how far apart the shades of a gradient will end up.
+func (self Palette) spacing() float32 {
+	if len(self) < 2 {
+		return 0
+	}
+	total := 0.0
+	for i, a := range(self) {
+		closest := math.Inf(1)
+		for j, b := range(self) {
+			if i == j {
+				continue
+			}
+			dr := float64(a.R) - float64(b.R)
+			dg := float64(a.G) - float64(b.G)
+			db := float64(a.B) - float64(b.B)
+			closest = math.Min(closest, math.Sqrt(dr * dr + dg * dg + db * db))
+		}
+		total += closest
+	}
+	return float32(total / float64(len(self)))
+}
+
+var bayer4 = [4][4]float32{
+	{0, 8, 2, 10},
+	{12, 4, 14, 6},
+	{3, 11, 1, 9},
+	{15, 7, 13, 5},
+}
+
+// Replace every colour in img with one from the palette, in place. Alpha is
+// left alone and fully transparent pixels are skipped.
+func (self Quantizer) Quantize(img *image.RGBA) QuantizeReport {
+	var report QuantizeReport
+	if len(self.Palette) == 0 {
+		return report
+	}
+
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	spread := self.Palette.spacing()
+
+	// Unpremultiplied colours, which Floyd-Steinberg adds its error to.
+	colours := make([]float32, width * height * 3)
+	for i := 0; i < width * height; i += 1 {
+		alpha := float32(img.Pix[i*4+3])
+		for c := 0; c < 3 && alpha > 0; c += 1 {
+			colours[i*3+c] = float32(img.Pix[i*4+c]) * 255 / alpha
+		}
+	}
+
+	for y := 0; y < height; y += 1 {
+		for x := 0; x < width; x += 1 {
+			i := y * width + x
+			alpha := img.Pix[i*4+3]
+			if alpha == 0 {
+				continue
+			}
+			report.Pixels += 1
+
+			r, g, b := colours[i*3], colours[i*3+1], colours[i*3+2]
+			if self.Dither == DitherOrdered {
+				offset := ((bayer4[y%4][x%4] + 0.5) / 16 - 0.5) * spread
+				r, g, b = r + offset, g + offset, b + offset
+			}
+			colour := self.Palette[self.Palette.nearest(r, g, b)]
+
+			if self.Dither == DitherFloydSteinberg {
+				replaced := [3]uint8{colour.R, colour.G, colour.B}
+				for c := 0; c < 3; c += 1 {
+					diffuse(colours, img.Pix, width, height, x, y, c, colours[i*3+c] - float32(replaced[c]))
+				}
+			}
+
+			pixel := [3]uint8{
+				uint8(uint32(colour.R) * uint32(alpha) / 255),
+				uint8(uint32(colour.G) * uint32(alpha) / 255),
+				uint8(uint32(colour.B) * uint32(alpha) / 255),
+			}
+			if pixel != [3]uint8{img.Pix[i*4], img.Pix[i*4+1], img.Pix[i*4+2]} {
+				report.Remapped += 1
+			}
+			copy(img.Pix[i*4:], pixel[:])
+		}
+	}
+
+	return report
+}
+
+// Push the error in one channel of a pixel onto its neighbours which haven't
+// been quantized yet. Transparent neighbours and those off the edge of the
+// image don't take any, and their share is spread over the rest so none of the
+// error is lost.
+func diffuse(colours []float32, pix []uint8, width, height, x, y, channel int, err float32) {
+	neighbours := [4]struct{
+		dx int
+		dy int
+		weight float32
+	}{
+		{1, 0, 7.0 / 16},
+		{-1, 1, 3.0 / 16},
+		{0, 1, 5.0 / 16},
+		{1, 1, 1.0 / 16},
+	}
+	var targets [4]int
+	var weights [4]float32
+	count := 0
+	total := float32(0)
+	for _, n := range(neighbours) {
+		nx, ny := x + n.dx, y + n.dy
+		if nx < 0 || nx >= width || ny >= height {
+			continue
+		}
+		i := ny * width + nx
+		if pix[i*4+3] == 0 {
+			continue
+		}
+		targets[count], weights[count] = i, n.weight
+		count += 1
+		total += n.weight
+	}
+	for j := 0; j < count; j += 1 {
+		colours[targets[j]*3+channel] += err * weights[j] / total
+	}
+}
@@ -0,0 +1,245 @@
+package textures
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParsePaletteLines(t *testing.T) {
+	tests := []struct{
+		name string
+		parse func(line string, number int) (*color.RGBA, error)
+		line string
+		number int
+		colour *color.RGBA
+		fails bool
+	}{
+		{"gpl header", parseGPLLine, "GIMP Palette", 1, nil, false},
+		{"gpl bad header", parseGPLLine, "JASC-PAL", 1, nil, true},
+		{"gpl setting", parseGPLLine, "Columns: 8", 2, nil, false},
+		{"gpl comment", parseGPLLine, "# made by hand", 3, nil, false},
+		{"gpl colour", parseGPLLine, "255 128 0 orange", 4, &color.RGBA{255, 128, 0, 255}, false},
+		{"gpl colour without a name", parseGPLLine, "1 2 3", 4, &color.RGBA{1, 2, 3, 255}, false},
+		{"gpl too few components", parseGPLLine, "1 2", 4, nil, true},
+		{"gpl out of range", parseGPLLine, "256 0 0", 4, nil, true},
+		{"hex", parseHexLine, "ff8000", 1, &color.RGBA{255, 128, 0, 255}, false},
+		{"hex with hash", parseHexLine, "#00ff80", 1, &color.RGBA{0, 255, 128, 255}, false},
+		{"hex too short", parseHexLine, "fff", 1, nil, true},
+		{"hex not hex", parseHexLine, "zzzzzz", 1, nil, true},
+	}
+
+	for _, test := range(tests) {
+		colour, err := test.parse(test.line, test.number)
+		if (err != nil) != test.fails {
+			t.Errorf("%v: error %v", test.name, err)
+			continue
+		}
+		if (colour == nil) != (test.colour == nil) || colour != nil && *colour != *test.colour {
+			t.Errorf("%v: got %v, expected %v", test.name, colour, test.colour)
+		}
+	}
+}
+
+func TestLoadPalette(t *testing.T) {
+	dir, err := ioutil.TempDir("", "palette")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	swatch := image.NewRGBA(image.Rect(0, 0, 4, 1))
+	swatch.SetRGBA(0, 0, color.RGBA{255, 0, 0, 255})
+	swatch.SetRGBA(1, 0, color.RGBA{255, 0, 0, 255})
+	swatch.SetRGBA(2, 0, color.RGBA{0, 0, 255, 255})
+	// Transparent pixels aren't part of the palette
+	swatch.SetRGBA(3, 0, color.RGBA{0, 0, 0, 0})
+	file, err := os.Create(filepath.Join(dir, "swatch.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = png.Encode(file, swatch)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"colours.gpl": "GIMP Palette\nName: test\n#\n255 0 0 red\n0 0 255 blue\n",
+		"colours.hex": "ff0000\n\n0000ff\n",
+		"empty.hex": "\n",
+		"broken.gpl": "GIMP Palette\nred\n",
+	}
+	for name, contents := range(files) {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	redBlue := Palette{{255, 0, 0, 255}, {0, 0, 255, 255}}
+	tests := []struct{
+		filename string
+		palette Palette
+		fails bool
+	}{
+		{"colours.gpl", redBlue, false},
+		{"colours.hex", redBlue, false},
+		{"swatch.png", redBlue, false},
+		{"empty.hex", nil, true},
+		{"broken.gpl", nil, true},
+		{"missing.gpl", nil, true},
+	}
+
+	for _, test := range(tests) {
+		palette, err := LoadPalette(filepath.Join(dir, test.filename))
+		if (err != nil) != test.fails {
+			t.Errorf("%v: error %v", test.filename, err)
+			continue
+		}
+		if len(palette) != len(test.palette) {
+			t.Errorf("%v: got %v, expected %v", test.filename, palette, test.palette)
+			continue
+		}
+		for i := range(palette) {
+			if palette[i] != test.palette[i] {
+				t.Errorf("%v: got %v, expected %v", test.filename, palette, test.palette)
+				break
+			}
+		}
+	}
+}
+
+// A horizontal grey ramp with a transparent pixel in the corner.
+func ramp() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 4))
+	for y := 0; y < 4; y += 1 {
+		for x := 0; x < 16; x += 1 {
+			grey := uint8(x * 17)
+			img.SetRGBA(x, y, color.RGBA{grey, grey, grey, 255})
+		}
+	}
+	img.SetRGBA(0, 0, color.RGBA{})
+	return img
+}
+
+func TestQuantize(t *testing.T) {
+	blackWhite := Palette{{0, 0, 0, 255}, {255, 255, 255, 255}}
+
+	for name, dither := range(DitherNames) {
+		img := ramp()
+		report := Quantizer{Palette: blackWhite, Dither: dither}.Quantize(img)
+
+		if report.Pixels != 16 * 4 - 1 {
+			t.Errorf("%v: counted %v pixels", name, report.Pixels)
+		}
+		whites := 0
+		remapped := 0
+		original := ramp()
+		for i := 0; i < len(img.Pix); i += 4 {
+			pixel := img.Pix[i:i+4]
+			if pixel[3] == 0 {
+				if pixel[0] != 0 || pixel[1] != 0 || pixel[2] != 0 {
+					t.Errorf("%v: transparent pixel became %v", name, pixel)
+				}
+				continue
+			}
+			if pixel[0] != pixel[1] || pixel[1] != pixel[2] || (pixel[0] != 0 && pixel[0] != 255) {
+				t.Errorf("%v: pixel %v isn't in the palette", name, pixel)
+			}
+			if pixel[0] == 255 {
+				whites += 1
+			}
+			if pixel[0] != original.Pix[i] {
+				remapped += 1
+			}
+		}
+		if report.Remapped != remapped {
+			t.Errorf("%v: reported %v remapped pixels, but %v changed", name, report.Remapped, remapped)
+		}
+		// Every dither keeps the ramp about half white.
+		if whites < 24 || whites > 40 {
+			t.Errorf("%v: %v of %v pixels are white", name, whites, report.Pixels)
+		}
+	}
+}
+
+func TestQuantizeSettings(t *testing.T) {
+	defer func(previous *Quantizer) {
+		DefaultQuantizer = previous
+	}(DefaultQuantizer)
+
+	var reported []string
+	DefaultQuantizer = &Quantizer{
+		Palette: Palette{{0, 0, 0, 255}},
+		Report: func(filename string, report QuantizeReport) {
+			reported = append(reported, filename)
+		},
+	}
+
+	tests := []struct{
+		name string
+		quantize bool
+		changed bool
+	}{
+		{"quantized", true, true},
+		{"left alone", false, false},
+	}
+
+	for _, test := range(tests) {
+		reported = nil
+		settings := DefaultSettings
+		settings.Quantize = test.quantize
+		img := ramp()
+		quantize(test.name, img, settings)
+
+		changed := false
+		for i, value := range(ramp().Pix) {
+			if img.Pix[i] != value {
+				changed = true
+			}
+		}
+		if changed != test.changed {
+			t.Errorf("%v: changed is %v", test.name, changed)
+		}
+		if test.quantize != (len(reported) == 1 && reported[0] == test.name) {
+			t.Errorf("%v: reported %v", test.name, reported)
+		}
+	}
+}
+
+// All of a pixel's error goes to the neighbours which can take it.
+func TestDiffuse(t *testing.T) {
+	tests := []struct{
+		name string
+		// Alpha of a 3x2 image, whose middle top pixel's error is diffused
+		alpha [6]uint8
+		// What each pixel receives
+		shares [6]float32
+	}{
+		{"all opaque", [6]uint8{255, 255, 255, 255, 255, 255}, [6]float32{0, 0, 7, 3, 5, 1}},
+		{"transparent right", [6]uint8{255, 255, 0, 255, 255, 255}, [6]float32{0, 0, 0, 16 * 3.0 / 9, 16 * 5.0 / 9, 16 * 1.0 / 9}},
+		{"only below", [6]uint8{255, 255, 0, 0, 255, 0}, [6]float32{0, 0, 0, 0, 16, 0}},
+		{"nothing to take it", [6]uint8{255, 255, 0, 0, 0, 0}, [6]float32{}},
+	}
+
+	for _, test := range(tests) {
+		colours := make([]float32, 6 * 3)
+		pix := make([]uint8, 6 * 4)
+		for i, alpha := range(test.alpha) {
+			pix[i*4+3] = alpha
+		}
+		diffuse(colours, pix, 3, 2, 1, 0, 1, 16)
+
+		for i := range(test.shares) {
+			if math.Abs(float64(colours[i*3+1] - test.shares[i])) > 1e-5 || colours[i*3] != 0 || colours[i*3+2] != 0 {
+				t.Errorf("%v: pixel %v got %v, expected %v in green", test.name, i, colours[i*3:i*3+3], test.shares[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package textures
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/go-gl/gl/v3.2-core/gl"
+	"io/ioutil"
+	"os"
+)
+
+// How a texture is sampled and uploaded. Any of these can be set for a texture
+// by a sidecar file next to it, named like wall_stone.png.json:
+//
+//	{"filter": "nearest", "wrap": "clamp", "mipmaps": false}
+//
+// Settings the file leaves out keep their defaults.
+type Settings struct{
+	// "linear" or "nearest", for both magnifying and minifying.
+	Filter string `json:"filter"`
+	// "repeat", "clamp" or "mirror".
+	Wrap string `json:"wrap"`
+	Mipmaps bool `json:"mipmaps"`
+	// "srgb" for colour images, or "linear" for data like normal maps.
+	ColourSpace string `json:"colourSpace"`
+	// Maximum anisotropic filtering samples, clamped to what the driver
+	// supports. 1 turns it off.
+	Anisotropy float32 `json:"anisotropy"`
+	// Whether DefaultQuantizer applies to the texture. Turn it off for data
+	// like normal maps, which a palette would ruin.
+	Quantize bool `json:"quantize"`
+}
+
+var DefaultSettings = Settings{
+	Filter: "linear",
+	Wrap: "repeat",
+	Mipmaps: true,
+	ColourSpace: "srgb",
+	Anisotropy: 1,
+	Quantize: true,
+}
+
+var (
+	filters = map[string]int32{
+		"linear": gl.LINEAR,
+		"nearest": gl.NEAREST,
+	}
+	mipmapFilters = map[string]int32{
+		"linear": gl.LINEAR_MIPMAP_LINEAR,
+		"nearest": gl.NEAREST_MIPMAP_LINEAR,
+	}
+	wraps = map[string]int32{
+		"repeat": gl.REPEAT,
+		"clamp": gl.CLAMP_TO_EDGE,
+		"mirror": gl.MIRRORED_REPEAT,
+	}
+	colourSpaces = map[string]int32{
+		"srgb": gl.SRGB_ALPHA,
+		"linear": gl.RGBA8,
+	}
+)
+
+// From EXT_texture_filter_anisotropic, which the core profile bindings don't
+// include even though almost every driver supports it.
+const (
+	textureMaxAnisotropy = 0x84FE
+	maxTextureMaxAnisotropy = 0x84FF
+)
+
+// The sidecar file holding a texture's settings.
+func SettingsFilename(filename string) string {
+	return filename + ".json"
+}
+
+// Read a texture's sidecar file. Textures without one get DefaultSettings.
+func LoadSettings(filename string) (Settings, error) {
+	settings := DefaultSettings
+
+	data, err := ioutil.ReadFile(SettingsFilename(filename))
+	if os.IsNotExist(err) {
+		return settings, nil
+	}
+	if err != nil {
+		return settings, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&settings)
+	if err != nil {
+		return DefaultSettings, fmt.Errorf("%v: %v", SettingsFilename(filename), err)
+	}
+
+	err = settings.validate()
+	if err != nil {
+		return DefaultSettings, fmt.Errorf("%v: %v", SettingsFilename(filename), err)
+	}
+
+	return settings, nil
+}
+
+func (self Settings) validate() error {
+	if _, ok := filters[self.Filter]; !ok {
+		return fmt.Errorf("unknown filter %q, expected linear or nearest", self.Filter)
+	}
+	if _, ok := wraps[self.Wrap]; !ok {
+		return fmt.Errorf("unknown wrap %q, expected repeat, clamp or mirror", self.Wrap)
+	}
+	if _, ok := colourSpaces[self.ColourSpace]; !ok {
+		return fmt.Errorf("unknown colour space %q, expected srgb or linear", self.ColourSpace)
+	}
+	if self.Anisotropy < 1 {
+		return fmt.Errorf("anisotropy must be at least 1, not %v", self.Anisotropy)
+	}
+	return nil
+}
+
+// Set the sampler parameters of the texture bound to TEXTURE_2D.
+func (self Settings) apply() {
+	minFilter := filters[self.Filter]
+	if self.Mipmaps {
+		minFilter = mipmapFilters[self.Filter]
+	}
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, wraps[self.Wrap])
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, wraps[self.Wrap])
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, minFilter)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, filters[self.Filter])
+
+	// Drivers without the extension leave the limit at 0.
+	var maxAnisotropy float32
+	gl.GetFloatv(maxTextureMaxAnisotropy, &maxAnisotropy)
+	if maxAnisotropy >= 1 {
+		anisotropy := self.Anisotropy
+		if anisotropy > maxAnisotropy {
+			anisotropy = maxAnisotropy
+		}
+		gl.TexParameterf(gl.TEXTURE_2D, textureMaxAnisotropy, anisotropy)
+	}
+}
@@ -0,0 +1,59 @@
+package textures
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadSettings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "settings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	nearest := DefaultSettings
+	nearest.Filter = "nearest"
+	nearest.Mipmaps = false
+	data := DefaultSettings
+	data.ColourSpace = "linear"
+	data.Quantize = false
+
+	tests := []struct{
+		name string
+		// Contents of the sidecar, or "" for none.
+		sidecar string
+		settings Settings
+		fails bool
+	}{
+		{"no sidecar", "", DefaultSettings, false},
+		{"empty", "{}", DefaultSettings, false},
+		{"some settings", `{"filter": "nearest", "mipmaps": false}`, nearest, false},
+		{"normal map", `{"colourSpace": "linear", "quantize": false}`, data, false},
+		{"unknown setting", `{"filtre": "nearest"}`, DefaultSettings, true},
+		{"unknown filter", `{"filter": "cubic"}`, DefaultSettings, true},
+		{"unknown wrap", `{"wrap": "tile"}`, DefaultSettings, true},
+		{"no anisotropy", `{"anisotropy": 0}`, DefaultSettings, true},
+		{"not json", `filter: nearest`, DefaultSettings, true},
+	}
+
+	for i, test := range(tests) {
+		filename := filepath.Join(dir, string(rune('a' + i)) + ".png")
+		if test.sidecar != "" {
+			err := ioutil.WriteFile(SettingsFilename(filename), []byte(test.sidecar), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		settings, err := LoadSettings(filename)
+		if (err != nil) != test.fails {
+			t.Errorf("%v: error %v", test.name, err)
+		}
+		if settings != test.settings {
+			t.Errorf("%v: got %+v, expected %+v", test.name, settings, test.settings)
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package textures
 
 import (
-	"github.com/fsnotify/fsnotify"
+	"fmt"
+	watch "github.com/crabmusket/lowrezjam2017/watch"
 	"image"
+	"sync"
 	"time"
 )
 
@@ -10,62 +12,150 @@ type TextureUpdate struct {
 	Data []byte
 	Size *image.Point
 	Texture *Texture
+	// New settings from the texture's sidecar file, if they were reloaded.
+	Settings *Settings
 }
 
+// Updates waiting for the main thread. Only the latest update for each texture
+// is kept, so saving an image several times in a row only uploads it once.
 var (
-	updates chan *TextureUpdate
+	updatesLock sync.Mutex
+	updates []*TextureUpdate
 )
 
-func init() {
-	updates = make(chan *TextureUpdate, 10)
+func queueUpdate(update *TextureUpdate) {
+	updatesLock.Lock()
+	defer updatesLock.Unlock()
+
+	if update.Texture.released {
+		return
+	}
+	for i, pending := range(updates) {
+		if pending.Texture == update.Texture {
+			updates[i] = update
+			return
+		}
+	}
+	updates = append(updates, update)
+}
+
+// Forget any pending update to a texture which is about to be deleted, so it
+// isn't brought back by uploading to it. Unwatching doesn't wait for a reload
+// which has already started, so any update queued after this is dropped too.
+func release(texture *Texture) {
+	updatesLock.Lock()
+	defer updatesLock.Unlock()
+
+	texture.released = true
+	for i, pending := range(updates) {
+		if pending.Texture == texture {
+			updates = append(updates[:i], updates[i+1:]...)
+			return
+		}
+	}
+}
+
+func nextUpdate() *TextureUpdate {
+	updatesLock.Lock()
+	defer updatesLock.Unlock()
+
+	if len(updates) == 0 {
+		return nil
+	}
+	update := updates[0]
+	updates = updates[1:]
+	return update
 }
 
-// You must call this function from the main thread which is running opengl.
-func ProcessUpdates() {
-	select {
-	case update := <-updates:
-		// TODO: release textures
+// Upload pending updates until there are none left or budget has been spent,
+// calling report after each one. At least one update is uploaded each call so
+// reloads can't be starved. You must call this function from the main thread
+// which is running opengl.
+func ProcessUpdates(budget time.Duration, report func(*TextureUpdate)) {
+	start := time.Now()
+
+	for {
+		update := nextUpdate()
+		if update == nil {
+			return
+		}
+
+		// Uploading to the same texture replaces its old storage, so nothing
+		// using the texture needs to know it changed.
+		if update.Settings != nil {
+			update.Texture.Settings = *update.Settings
+		}
 		update.Texture.Bind(update.Data, update.Size)
-	default:
-		// do nothing
+
+		if report != nil {
+			report(update)
+		}
+
+		if time.Since(start) >= budget {
+			return
+		}
 	}
 }
 
-func (self *Texture) Watch() error {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		return err
+// Reload the texture when its image, its GIMP source or its sidecar settings
+// file changes. Broken settings are reported and the texture keeps its old
+// ones.
+func (self *Texture) Watch(watcher *watch.Watcher) error {
+	reload := func(string) {
+		// Broken settings still leave the image to be quantized or not, and
+		// the defaults are the best guess.
+		settings, settingsErr := LoadSettings(self.Filename)
+		if settingsErr != nil {
+			fmt.Println(settingsErr)
+		}
+		data, size, err := loadImage(self.Filename, settings)
+		if err != nil {
+			return
+		}
+		update := &TextureUpdate{
+			Data: data,
+			Size: size,
+			Texture: self,
+		}
+		if settingsErr == nil {
+			update.Settings = &settings
+		}
+		queueUpdate(update)
 	}
 
-	err = watcher.Add(self.Filename)
-	if err != nil {
-		return err
+	handles, err := watchAll(watcher, reload, self.watchedFilenames()...)
+	self.watches = append(self.watches, handles...)
+	return err
+}
+
+func (self *Texture) Unwatch(watcher *watch.Watcher) {
+	for _, handle := range(self.watches) {
+		watcher.Unwatch(handle)
 	}
+	self.watches = nil
+}
 
-	go func() {
-		for {
-			select {
-			case event := <-watcher.Events:
-				if event.Name == self.Filename {
-					data, size, err := loadImage(self.Filename)
-					if err != nil {
-						continue
-					}
-					update := &TextureUpdate{
-						Data: data,
-						Size: size,
-						Texture: self,
-					}
-					updates <- update
-				}
-
-			default:
-				// do nothing
-			}
-
-			time.Sleep(100 * time.Millisecond)
+func (self *Texture) watchedFilenames() []string {
+	return []string{self.Filename, SourceFilename(self.Filename), SettingsFilename(self.Filename)}
+}
+
+// Watch each of filenames once, since a texture loaded straight from its GIMP
+// file is its own source. The handles are returned even on error, so whatever
+// was watched can still be unwatched.
+func watchAll(watcher *watch.Watcher, handler watch.Handler, filenames ...string) ([]watch.Handle, error) {
+	var handles []watch.Handle
+	seen := make(map[string]bool)
+	for _, filename := range(filenames) {
+		if seen[filename] {
+			continue
 		}
-	}()
+		seen[filename] = true
 
-	return nil
+		handle, err := watcher.Watch(filename, handler)
+		if err != nil {
+			return handles, err
+		}
+		handles = append(handles, handle)
+	}
+	return handles, nil
 }
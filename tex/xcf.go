@@ -0,0 +1,693 @@
+package textures
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+// GIMP's own file format, so textures can be loaded straight from the files
+// artists save rather than waiting for them to export a png. Only 8-bit images
+// are supported. Visible layers are flattened with their opacity, masks and
+// blend mode, falling back to normal blending for modes other than the common
+// separable ones.
+func init() {
+	image.RegisterFormat("xcf", "gimp xcf ", decodeXCF, decodeXCFConfig)
+}
+
+const (
+	xcfPropEnd = 0
+	xcfPropColormap = 1
+	xcfPropOpacity = 6
+	xcfPropMode = 7
+	xcfPropVisible = 8
+	xcfPropApplyMask = 11
+	xcfPropOffsets = 15
+	xcfPropCompression = 17
+	xcfPropGroupItem = 29
+	xcfPropItemPath = 30
+	xcfPropFloatOpacity = 33
+)
+
+const (
+	xcfCompressNone = 0
+	xcfCompressRLE = 1
+	xcfCompressZlib = 2
+)
+
+const xcfTileSize = 64
+
+// Image types, which for layers are also whether they have alpha.
+const (
+	xcfRGB = 0
+	xcfRGBA = 1
+	xcfGray = 2
+	xcfGrayA = 3
+	xcfIndexed = 4
+	xcfIndexedA = 5
+)
+
+var xcfBytesPerPixel = map[uint32]int{
+	xcfRGB: 3,
+	xcfRGBA: 4,
+	xcfGray: 1,
+	xcfGrayA: 2,
+	xcfIndexed: 1,
+	xcfIndexedA: 2,
+}
+
+// Blend modes by their number in the file. GIMP 2.10 added new versions of
+// the old modes, which are blended the same way here.
+var xcfBlendModes = map[uint32]func(b, s float32) float32{
+	3: blendMultiply,
+	4: blendScreen,
+	5: blendOverlay,
+	6: blendDifference,
+	7: blendAddition,
+	8: blendSubtract,
+	9: blendDarken,
+	10: blendLighten,
+	23: blendOverlay,
+	30: blendMultiply,
+	31: blendScreen,
+	32: blendDifference,
+	33: blendAddition,
+	34: blendSubtract,
+	35: blendDarken,
+	36: blendLighten,
+}
+
+type xcfImage struct{
+	version int
+	width int
+	height int
+	kind uint32
+	linear bool
+	compression byte
+	colormap []color.NRGBA
+	layers []*xcfLayer
+}
+
+type xcfLayer struct{
+	width int
+	height int
+	kind uint32
+	x int
+	y int
+	opacity float32
+	visible bool
+	mode uint32
+	applyMask bool
+	group bool
+	// How deeply the layer is nested in groups, with 1 at the top.
+	depth int
+	children []*xcfLayer
+
+	pixels []byte
+	mask []byte
+}
+
+func decodeXCFConfig(reader io.Reader) (image.Config, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return image.Config{}, err
+	}
+
+	r := &xcfReader{data: data}
+	img := r.header()
+	if r.err != nil {
+		return image.Config{}, r.err
+	}
+
+	config := image.Config{
+		ColorModel: color.NRGBAModel,
+		Width: img.width,
+		Height: img.height,
+	}
+	return config, nil
+}
+
+func decodeXCF(reader io.Reader) (image.Image, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &xcfReader{data: data}
+	img := r.header()
+	r.imageProperties(img)
+
+	var pointers []uint64
+	for pointer := r.pointer(); pointer != 0 && r.err == nil; pointer = r.pointer() {
+		pointers = append(pointers, pointer)
+	}
+	for _, pointer := range(pointers) {
+		img.layers = append(img.layers, r.layer(img, pointer))
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	canvas := make([]float32, img.width * img.height * 4)
+	img.flatten(nest(img.layers), canvas)
+
+	out := image.NewNRGBA(image.Rect(0, 0, img.width, img.height))
+	for i, value := range(canvas) {
+		out.Pix[i] = uint8(clamp(value) * 255 + 0.5)
+	}
+	return out, nil
+}
+
+// Turn the file's flat list of layers, where each group is followed by its
+// children, into a tree.
+func nest(layers []*xcfLayer) []*xcfLayer {
+	var top []*xcfLayer
+	var groups []*xcfLayer
+	for _, layer := range(layers) {
+		for len(groups) >= layer.depth {
+			groups = groups[:len(groups)-1]
+		}
+		if len(groups) == 0 {
+			top = append(top, layer)
+		} else {
+			parent := groups[len(groups)-1]
+			parent.children = append(parent.children, layer)
+		}
+		if layer.group {
+			groups = append(groups, layer)
+		}
+	}
+	return top
+}
+
+// Composite layers onto canvas from the bottom up. Layers are listed top
+// first. The canvas is non-premultiplied RGBA.
+func (self *xcfImage) flatten(layers []*xcfLayer, canvas []float32) {
+	for i := len(layers) - 1; i >= 0; i -= 1 {
+		layer := layers[i]
+		if !layer.visible || layer.opacity == 0 {
+			continue
+		}
+
+		var at func(x, y int) [4]float32
+		if layer.group {
+			// Groups are flattened on their own first, then blended as one layer.
+			group := make([]float32, len(canvas))
+			self.flatten(layer.children, group)
+			at = func(x, y int) [4]float32 {
+				i := ((y + layer.y) * self.width + x + layer.x) * 4
+				return [4]float32{group[i], group[i+1], group[i+2], group[i+3]}
+			}
+		} else {
+			at = func(x, y int) [4]float32 {
+				return self.pixel(layer, x, y)
+			}
+		}
+
+		blend := xcfBlendModes[layer.mode]
+		for y := 0; y < layer.height; y += 1 {
+			cy := y + layer.y
+			if cy < 0 || cy >= self.height {
+				continue
+			}
+			for x := 0; x < layer.width; x += 1 {
+				cx := x + layer.x
+				if cx < 0 || cx >= self.width {
+					continue
+				}
+
+				src := at(x, y)
+				src[3] *= layer.opacity
+				if layer.applyMask && layer.mask != nil {
+					src[3] *= float32(layer.mask[y * layer.width + x]) / 255
+				}
+				if src[3] == 0 {
+					continue
+				}
+				composite(canvas[(cy * self.width + cx) * 4:], src, blend)
+			}
+		}
+	}
+}
+
+// A layer's pixel as non-premultiplied RGBA.
+func (self *xcfImage) pixel(layer *xcfLayer, x, y int) [4]float32 {
+	bpp := xcfBytesPerPixel[layer.kind]
+	p := layer.pixels[(y * layer.width + x) * bpp:]
+
+	var rgba [4]uint8
+	switch layer.kind {
+	case xcfRGB, xcfRGBA:
+		rgba = [4]uint8{p[0], p[1], p[2], 255}
+	case xcfGray, xcfGrayA:
+		rgba = [4]uint8{p[0], p[0], p[0], 255}
+	case xcfIndexed, xcfIndexedA:
+		if int(p[0]) < len(self.colormap) {
+			c := self.colormap[p[0]]
+			rgba = [4]uint8{c.R, c.G, c.B, 255}
+		}
+	}
+	if layer.kind == xcfRGBA || layer.kind == xcfGrayA || layer.kind == xcfIndexedA {
+		rgba[3] = p[bpp-1]
+	}
+
+	var out [4]float32
+	for c := range(rgba) {
+		out[c] = float32(rgba[c]) / 255
+	}
+	if self.linear {
+		for c := 0; c < 3; c += 1 {
+			out[c] = linearToSRGB(out[c])
+		}
+	}
+	return out
+}
+
+// Blend src over dst in place using a separable blend mode, or normal
+// blending if blend is nil.
+func composite(dst []float32, src [4]float32, blend func(b, s float32) float32) {
+	as, ab := src[3], dst[3]
+	ao := as + ab * (1 - as)
+	for c := 0; c < 3; c += 1 {
+		cs, cb := src[c], dst[c]
+		if blend != nil {
+			cs = (1 - ab) * cs + ab * clamp(blend(cb, cs))
+		}
+		dst[c] = (as * cs + ab * cb * (1 - as)) / ao
+	}
+	dst[3] = ao
+}
+
+func blendMultiply(b, s float32) float32 {
+	return b * s
+}
+
+func blendScreen(b, s float32) float32 {
+	return 1 - (1 - b) * (1 - s)
+}
+
+func blendOverlay(b, s float32) float32 {
+	if b < 0.5 {
+		return 2 * b * s
+	}
+	return 1 - 2 * (1 - b) * (1 - s)
+}
+
+func blendDifference(b, s float32) float32 {
+	return float32(math.Abs(float64(b - s)))
+}
+
+func blendAddition(b, s float32) float32 {
+	return b + s
+}
+
+func blendSubtract(b, s float32) float32 {
+	return b - s
+}
+
+func blendDarken(b, s float32) float32 {
+	return float32(math.Min(float64(b), float64(s)))
+}
+
+func blendLighten(b, s float32) float32 {
+	return float32(math.Max(float64(b), float64(s)))
+}
+
+func clamp(v float32) float32 {
+	if v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
+
+func linearToSRGB(v float32) float32 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return float32(1.055 * math.Pow(float64(v), 1 / 2.4) - 0.055)
+}
+
+// Reads big-endian values from anywhere in the file, since it's full of
+// pointers. The first error stops all further reads and is kept in err.
+type xcfReader struct{
+	data []byte
+	pos int
+	version int
+	err error
+}
+
+func (self *xcfReader) fail(format string, args ...interface{}) {
+	if self.err == nil {
+		self.err = fmt.Errorf("xcf: " + format, args...)
+	}
+}
+
+func (self *xcfReader) seek(pointer uint64) {
+	if pointer > uint64(len(self.data)) {
+		self.fail("pointer %v is past the end of the file", pointer)
+		return
+	}
+	self.pos = int(pointer)
+}
+
+func (self *xcfReader) bytes(n int) []byte {
+	if self.err != nil {
+		return nil
+	}
+	if n < 0 || self.pos + n > len(self.data) {
+		self.fail("unexpected end of file")
+		return nil
+	}
+	data := self.data[self.pos:self.pos+n]
+	self.pos += n
+	return data
+}
+
+func (self *xcfReader) byte() byte {
+	data := self.bytes(1)
+	if data == nil {
+		return 0
+	}
+	return data[0]
+}
+
+func (self *xcfReader) uint16() uint16 {
+	data := self.bytes(2)
+	if data == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(data)
+}
+
+func (self *xcfReader) uint32() uint32 {
+	data := self.bytes(4)
+	if data == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(data)
+}
+
+func (self *xcfReader) float32() float32 {
+	return math.Float32frombits(self.uint32())
+}
+
+// Pointers grew to 64 bits in version 11.
+func (self *xcfReader) pointer() uint64 {
+	if self.version >= 11 {
+		data := self.bytes(8)
+		if data == nil {
+			return 0
+		}
+		return binary.BigEndian.Uint64(data)
+	}
+	return uint64(self.uint32())
+}
+
+// Strings are stored with their length, which includes a trailing NUL.
+func (self *xcfReader) string() string {
+	data := self.bytes(int(self.uint32()))
+	if len(data) > 0 {
+		data = data[:len(data)-1]
+	}
+	return string(data)
+}
+
+// Check that a width and height are sane, so a corrupt file can't make us
+// allocate too much. Flattening takes 16 bytes a pixel for the canvas and
+// again for each level of nested groups, so this allows 2048x2048 images at
+// 64MiB a canvas, which is plenty for low resolution textures.
+func (self *xcfReader) size(width, height uint32) (int, int) {
+	const maxPixels = 1 << 22
+	if self.err == nil && (width == 0 || height == 0 || uint64(width) * uint64(height) > maxPixels) {
+		self.fail("bad size %vx%v", width, height)
+	}
+	if self.err != nil {
+		return 0, 0
+	}
+	return int(width), int(height)
+}
+
+func (self *xcfReader) header() *xcfImage {
+	magic := self.bytes(14)
+	if self.err != nil || string(magic[:9]) != "gimp xcf " || magic[13] != 0 {
+		self.fail("not a GIMP image")
+		return &xcfImage{}
+	}
+	if tag := string(magic[9:13]); tag != "file" {
+		if _, err := fmt.Sscanf(tag, "v%03d", &self.version); err != nil {
+			self.fail("unknown version %q", tag)
+		}
+	}
+
+	img := &xcfImage{version: self.version}
+	img.width, img.height = self.size(self.uint32(), self.uint32())
+	img.kind = self.uint32()
+	if self.err == nil && img.kind > xcfIndexed {
+		self.fail("unknown image type %v", img.kind)
+	}
+
+	if self.version >= 4 {
+		precision := self.uint32()
+		switch {
+		case self.version == 4 && precision == 0:
+		case self.version > 4 && precision == 150:
+		case self.version > 4 && precision == 100:
+			img.linear = true
+		default:
+			self.fail("only 8-bit images are supported, not precision %v", precision)
+		}
+	}
+
+	return img
+}
+
+func (self *xcfReader) imageProperties(img *xcfImage) {
+	for self.err == nil {
+		kind, length := self.uint32(), self.uint32()
+		if kind == xcfPropEnd {
+			return
+		}
+		end := self.pos + int(length)
+
+		switch kind {
+		case xcfPropCompression:
+			img.compression = self.byte()
+			if img.compression > xcfCompressZlib {
+				self.fail("unknown compression %v", img.compression)
+			}
+		case xcfPropColormap:
+			count := int(self.uint32())
+			data := self.bytes(count * 3)
+			for i := 0; i < count && self.err == nil; i += 1 {
+				img.colormap = append(img.colormap, color.NRGBA{data[i*3], data[i*3+1], data[i*3+2], 255})
+			}
+			// Version 0 files have the wrong length here.
+			end = self.pos
+		}
+
+		self.seek(uint64(end))
+	}
+}
+
+func (self *xcfReader) layer(img *xcfImage, pointer uint64) *xcfLayer {
+	self.seek(pointer)
+	layer := &xcfLayer{
+		opacity: 1,
+		visible: true,
+		depth: 1,
+	}
+	layer.width, layer.height = self.size(self.uint32(), self.uint32())
+	layer.kind = self.uint32()
+	self.string()
+
+	for self.err == nil {
+		kind, length := self.uint32(), self.uint32()
+		if kind == xcfPropEnd {
+			break
+		}
+		end := self.pos + int(length)
+
+		switch kind {
+		case xcfPropOpacity:
+			layer.opacity = float32(self.uint32()) / 255
+		case xcfPropFloatOpacity:
+			layer.opacity = clamp(self.float32())
+		case xcfPropVisible:
+			layer.visible = self.uint32() != 0
+		case xcfPropMode:
+			layer.mode = self.uint32()
+		case xcfPropApplyMask:
+			layer.applyMask = self.uint32() != 0
+		case xcfPropOffsets:
+			layer.x = int(int32(self.uint32()))
+			layer.y = int(int32(self.uint32()))
+		case xcfPropGroupItem:
+			layer.group = true
+		case xcfPropItemPath:
+			if length >= 4 {
+				layer.depth = int(length / 4)
+			}
+		}
+
+		self.seek(uint64(end))
+	}
+
+	bpp, ok := xcfBytesPerPixel[layer.kind]
+	if self.err == nil && !ok {
+		self.fail("unknown layer type %v", layer.kind)
+	}
+
+	hierarchy := self.pointer()
+	mask := self.pointer()
+	if !layer.group {
+		layer.pixels = self.hierarchy(img, hierarchy, layer.width, layer.height, bpp)
+	}
+	if mask != 0 && layer.applyMask {
+		layer.mask = self.channel(img, mask, layer.width, layer.height)
+	}
+
+	return layer
+}
+
+// A layer mask, which is a channel the same size as its layer.
+func (self *xcfReader) channel(img *xcfImage, pointer uint64, width, height int) []byte {
+	self.seek(pointer)
+	self.uint32()
+	self.uint32()
+	self.string()
+	for self.err == nil {
+		kind, length := self.uint32(), self.uint32()
+		if kind == xcfPropEnd {
+			break
+		}
+		self.seek(uint64(self.pos + int(length)))
+	}
+	return self.hierarchy(img, self.pointer(), width, height, 1)
+}
+
+// Read the full-size level of a hierarchy into one interleaved array.
+func (self *xcfReader) hierarchy(img *xcfImage, pointer uint64, width, height, bpp int) []byte {
+	self.seek(pointer)
+	w, h := self.size(self.uint32(), self.uint32())
+	stored := int(self.uint32())
+	if self.err == nil && (w != width || h != height || stored != bpp) {
+		self.fail("pixel data is %vx%v with %v bytes per pixel, expected %vx%v with %v", w, h, stored, width, height, bpp)
+	}
+	self.seek(self.pointer())
+	self.size(self.uint32(), self.uint32())
+	if self.err != nil {
+		return nil
+	}
+
+	tilesX := (width + xcfTileSize - 1) / xcfTileSize
+	tilesY := (height + xcfTileSize - 1) / xcfTileSize
+	tiles := make([]uint64, tilesX * tilesY)
+	for i := range(tiles) {
+		tiles[i] = self.pointer()
+	}
+
+	pixels := make([]byte, width * height * bpp)
+	for i, tile := range(tiles) {
+		x0, y0 := (i % tilesX) * xcfTileSize, (i / tilesX) * xcfTileSize
+		w := min(xcfTileSize, width - x0)
+		h := min(xcfTileSize, height - y0)
+
+		self.seek(tile)
+		data := self.tile(img.compression, w * h, bpp)
+		if self.err != nil {
+			return nil
+		}
+		for y := 0; y < h; y += 1 {
+			row := ((y0 + y) * width + x0) * bpp
+			copy(pixels[row:row + w * bpp], data[y * w * bpp:])
+		}
+	}
+	return pixels
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Read a tile of count pixels as interleaved bytes.
+func (self *xcfReader) tile(compression byte, count, bpp int) []byte {
+	switch compression {
+	case xcfCompressNone:
+		return self.bytes(count * bpp)
+	case xcfCompressZlib:
+		if self.err != nil {
+			return nil
+		}
+		reader, err := zlib.NewReader(bytes.NewReader(self.data[self.pos:]))
+		if err != nil {
+			self.fail("%v", err)
+			return nil
+		}
+		data := make([]byte, count * bpp)
+		_, err = io.ReadFull(reader, data)
+		if err != nil {
+			self.fail("%v", err)
+			return nil
+		}
+		return data
+	}
+
+	// Run-length encoding stores each channel separately, in runs of either
+	// one repeated byte or several literal bytes.
+	data := make([]byte, count * bpp)
+	for channel := 0; channel < bpp; channel += 1 {
+		i := 0
+		put := func(value byte) {
+			data[i * bpp + channel] = value
+			i += 1
+		}
+		for i < count && self.err == nil {
+			op := int(self.byte())
+			var run int
+			var literal bool
+			switch {
+			case op < 127:
+				run = op + 1
+			case op == 127:
+				run = int(self.uint16())
+			case op == 128:
+				run, literal = int(self.uint16()), true
+			default:
+				run, literal = 256 - op, true
+			}
+			if self.err == nil && i + run > count {
+				self.fail("run-length data overruns its tile")
+			}
+			if self.err != nil {
+				return nil
+			}
+
+			if literal {
+				for _, value := range(self.bytes(run)) {
+					put(value)
+				}
+			} else {
+				value := self.byte()
+				for j := 0; j < run; j += 1 {
+					put(value)
+				}
+			}
+		}
+	}
+	if self.err != nil {
+		return nil
+	}
+	return data
+}
@@ -0,0 +1,317 @@
+package textures
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"image/color"
+	_ "image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A layer for xcfFile to write. Properties are flattened into words, as
+// xcfProp makes them.
+type xcfTestLayer struct{
+	kind uint32
+	width int
+	height int
+	props []uint32
+	pixels []byte
+}
+
+func xcfProp(kind uint32, values ...uint32) []uint32 {
+	return append([]uint32{kind, uint32(4 * len(values))}, values...)
+}
+
+// Write a version 0 file of width by height pixels, with layers listed top
+// first. Each layer is small enough to be a single tile.
+func xcfFile(width, height int, compression byte, layers []xcfTestLayer) []byte {
+	var file bytes.Buffer
+	put := func(values ...uint32) {
+		binary.Write(&file, binary.BigEndian, values)
+	}
+
+	file.WriteString("gimp xcf file\x00")
+	put(uint32(width), uint32(height), xcfRGB)
+	put(xcfPropCompression, 1)
+	file.WriteByte(compression)
+	put(xcfPropEnd, 0)
+
+	// The layer structures all follow the list of pointers to them, so
+	// write them separately and fix up the pointers after.
+	table := file.Len()
+	put(make([]uint32, len(layers) + 1)...)
+
+	for i, layer := range(layers) {
+		binary.BigEndian.PutUint32(file.Bytes()[table + 4 * i:], uint32(file.Len()))
+
+		put(uint32(layer.width), uint32(layer.height), layer.kind)
+		put(6)
+		file.WriteString("layer\x00")
+		put(layer.props...)
+		put(xcfPropEnd, 0)
+		hierarchy := file.Len() + 8
+		put(uint32(hierarchy), 0)
+
+		put(uint32(layer.width), uint32(layer.height), uint32(xcfBytesPerPixel[layer.kind]))
+		level := file.Len() + 8
+		put(uint32(level), 0)
+		put(uint32(layer.width), uint32(layer.height))
+		put(uint32(file.Len() + 8), 0)
+		file.Write(xcfTile(compression, layer.pixels, xcfBytesPerPixel[layer.kind]))
+	}
+
+	return file.Bytes()
+}
+
+func xcfTile(compression byte, pixels []byte, bpp int) []byte {
+	switch compression {
+	case xcfCompressZlib:
+		var data bytes.Buffer
+		writer := zlib.NewWriter(&data)
+		writer.Write(pixels)
+		writer.Close()
+		return data.Bytes()
+
+	case xcfCompressRLE:
+		// Each channel is one run, repeated if it can be and literal if not.
+		var data []byte
+		count := len(pixels) / bpp
+		if count == 0 {
+			// Groups have no pixels of their own
+			return nil
+		}
+		for channel := 0; channel < bpp; channel += 1 {
+			var values []byte
+			for i := 0; i < count; i += 1 {
+				values = append(values, pixels[i * bpp + channel])
+			}
+			if bytes.Count(values, values[:1]) == count {
+				data = append(data, byte(count - 1), values[0])
+			} else {
+				data = append(data, byte(256 - count))
+				data = append(data, values...)
+			}
+		}
+		return data
+	}
+	return pixels
+}
+
+func solid(width, height int, pixel ...byte) []byte {
+	return bytes.Repeat(pixel, width * height)
+}
+
+func TestDecodeXCF(t *testing.T) {
+	checks := []byte{255, 0, 0, 0, 255, 0, 0, 0, 255, 255, 255, 255}
+	red := xcfTestLayer{kind: xcfRGB, width: 2, height: 2, pixels: solid(2, 2, 255, 0, 0)}
+	blue := xcfTestLayer{kind: xcfRGB, width: 2, height: 2, pixels: solid(2, 2, 0, 0, 255)}
+
+	tests := []struct{
+		name string
+		compression byte
+		layers []xcfTestLayer
+		pixels []byte
+	}{
+		{
+			"uncompressed", xcfCompressNone,
+			[]xcfTestLayer{{kind: xcfRGB, width: 2, height: 2, pixels: checks}},
+			[]byte{255, 0, 0, 255, 0, 255, 0, 255, 0, 0, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			"run-length", xcfCompressRLE,
+			[]xcfTestLayer{{kind: xcfRGB, width: 2, height: 2, pixels: checks}},
+			[]byte{255, 0, 0, 255, 0, 255, 0, 255, 0, 0, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			"zlib", xcfCompressZlib,
+			[]xcfTestLayer{{kind: xcfRGB, width: 2, height: 2, pixels: checks}},
+			[]byte{255, 0, 0, 255, 0, 255, 0, 255, 0, 0, 255, 255, 255, 255, 255, 255},
+		},
+		{
+			"grey with alpha", xcfCompressRLE,
+			[]xcfTestLayer{{kind: xcfGrayA, width: 2, height: 2, pixels: solid(2, 2, 100, 255)}},
+			solid(2, 2, 100, 100, 100, 255),
+		},
+		{
+			"hidden layer", xcfCompressRLE,
+			[]xcfTestLayer{{xcfRGB, 2, 2, xcfProp(xcfPropVisible, 0), red.pixels}, blue},
+			solid(2, 2, 0, 0, 255, 255),
+		},
+		{
+			"half opacity", xcfCompressRLE,
+			[]xcfTestLayer{{xcfRGB, 2, 2, xcfProp(xcfPropOpacity, 128), red.pixels}, blue},
+			solid(2, 2, 128, 0, 127, 255),
+		},
+		{
+			"offset", xcfCompressNone,
+			[]xcfTestLayer{{xcfRGB, 1, 1, xcfProp(xcfPropOffsets, 1, 1), []byte{255, 0, 0}}},
+			[]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 255, 0, 0, 255},
+		},
+		{
+			"multiply", xcfCompressRLE,
+			[]xcfTestLayer{
+				{xcfRGB, 2, 2, xcfProp(xcfPropMode, 3), solid(2, 2, 128, 128, 128)},
+				{kind: xcfRGB, width: 2, height: 2, pixels: solid(2, 2, 200, 200, 200)},
+			},
+			solid(2, 2, 100, 100, 100, 255),
+		},
+		{
+			// The red layer is inside the hidden group
+			"hidden group", xcfCompressRLE,
+			[]xcfTestLayer{
+				{xcfRGBA, 2, 2, append(xcfProp(xcfPropGroupItem), xcfProp(xcfPropVisible, 0)...), nil},
+				{xcfRGB, 2, 2, xcfProp(xcfPropItemPath, 0, 0), red.pixels},
+				blue,
+			},
+			solid(2, 2, 0, 0, 255, 255),
+		},
+	}
+
+	for _, test := range(tests) {
+		decoded, err := decodeXCF(bytes.NewReader(xcfFile(2, 2, test.compression, test.layers)))
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		img, ok := decoded.(*image.NRGBA)
+		if !ok || img.Bounds() != image.Rect(0, 0, 2, 2) {
+			t.Errorf("%v: expected a 2x2 NRGBA image, got %T of %v", test.name, decoded, decoded.Bounds())
+			continue
+		}
+		if !bytes.Equal(img.Pix, test.pixels) {
+			t.Errorf("%v: got pixels %v, expected %v", test.name, img.Pix, test.pixels)
+		}
+	}
+}
+
+// The textures are saved both ways, so the xcf should look exactly like the
+// png GIMP exported from it.
+func TestDecodeXCFTextures(t *testing.T) {
+	filenames, err := filepath.Glob("../resources/textures/*.xcf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filenames) == 0 {
+		t.Fatal("no xcf textures found")
+	}
+
+	for _, filename := range(filenames) {
+		xcf := decodeFile(t, filename)
+		png := decodeFile(t, strings.TrimSuffix(filename, ".xcf") + ".png")
+		if xcf.Bounds() != png.Bounds() {
+			t.Errorf("%v: size %v, expected %v", filename, xcf.Bounds(), png.Bounds())
+			continue
+		}
+
+		differences := 0
+		bounds := xcf.Bounds()
+		for y := bounds.Min.Y; y < bounds.Max.Y; y += 1 {
+			for x := bounds.Min.X; x < bounds.Max.X; x += 1 {
+				if color.NRGBAModel.Convert(xcf.At(x, y)) != color.NRGBAModel.Convert(png.At(x, y)) {
+					differences += 1
+				}
+			}
+		}
+		if differences != 0 {
+			t.Errorf("%v: %v pixels differ from the png", filename, differences)
+		}
+
+		file, err := os.Open(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config, format, err := image.DecodeConfig(file)
+		file.Close()
+		if err != nil || format != "xcf" || config.Width != bounds.Dx() || config.Height != bounds.Dy() {
+			t.Errorf("%v: config %+v as %v (%v)", filename, config, format, err)
+		}
+	}
+}
+
+func decodeFile(t *testing.T, filename string) image.Image {
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		t.Fatalf("%v: %v", filename, err)
+	}
+	return img
+}
+
+// Broken files should be errors, never panics or huge allocations.
+func TestDecodeXCFErrors(t *testing.T) {
+	good := xcfFile(2, 2, xcfCompressRLE, []xcfTestLayer{{kind: xcfRGB, width: 2, height: 2, pixels: solid(2, 2, 1, 2, 3)}})
+	corrupt := func(offset int, values ...byte) []byte {
+		data := append([]byte{}, good...)
+		copy(data[offset:], values)
+		return data
+	}
+
+	tests := []struct{
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"not xcf", []byte("\x89PNG\r\n\x1a\n not really")},
+		{"unknown version", corrupt(9, 'v', 'x', 'y', 'z')},
+		{"zero width", corrupt(14, 0, 0, 0, 0)},
+		{"huge", corrupt(14, 0xff, 0xff, 0xff, 0xff)},
+		{"unknown image type", corrupt(25, 9)},
+		{"unknown compression", corrupt(34, 7)},
+		// The run is longer than the 4 pixel tile
+		{"run overruns tile", corrupt(len(good) - 6, 9)},
+		{"empty zlib stream", xcfFile(2, 2, xcfCompressZlib, []xcfTestLayer{{kind: xcfRGB, width: 2, height: 2, pixels: nil}})},
+		{"short tile", xcfFile(2, 2, xcfCompressNone, []xcfTestLayer{{kind: xcfRGB, width: 2, height: 2, pixels: []byte{1, 2, 3}}})},
+	}
+	for length := 0; length < len(good); length += 1 {
+		tests = append(tests, struct{
+			name string
+			data []byte
+		}{"truncated", good[:length]})
+	}
+
+	for _, test := range(tests) {
+		_, err := decodeXCF(bytes.NewReader(test.data))
+		if err == nil {
+			t.Errorf("%v: %v bytes decoded without an error", test.name, len(test.data))
+		}
+	}
+
+	if _, err := decodeXCF(bytes.NewReader(good)); err != nil {
+		t.Errorf("the uncorrupted file should decode: %v", err)
+	}
+	if _, err := decodeXCFConfig(bytes.NewReader(good[:20])); err == nil {
+		t.Errorf("a truncated header should fail to decode its config")
+	}
+	// 2048x2048 is as big as an image can be, which is found out from the
+	// header before any pixels are read.
+	if _, err := decodeXCFConfig(bytes.NewReader(corrupt(14, 0, 0, 8, 0, 0, 0, 8, 0))); err != nil {
+		t.Errorf("a 2048x2048 image should be allowed: %v", err)
+	}
+	if _, err := decodeXCFConfig(bytes.NewReader(corrupt(14, 0, 0, 8, 0, 0, 0, 8, 1))); err == nil {
+		t.Errorf("a 2048x2049 image should be too big")
+	}
+}
+
+func TestDecodeXCFTruncated(t *testing.T) {
+	data, err := ioutil.ReadFile("../resources/textures/wall_stone.xcf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for length := 0; length < len(data); length += len(data) / 50 + 1 {
+		_, err := decodeXCF(bytes.NewReader(data[:length]))
+		if err == nil {
+			t.Errorf("wall_stone.xcf cut to %v bytes decoded without an error", length)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package watch
+
+import (
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// How long a file has to stay quiet after changing before it's reloaded.
+// Editors often write a file in several steps, and we only want to load it
+// once they're done.
+const DefaultDelay = 100 * time.Millisecond
+
+type Handler func(filename string)
+
+// One call to Watch, so that its handler can be removed without disturbing
+// any others on the same file.
+type Handle struct{
+	path string
+	id int
+}
+
+type watched struct{
+	id int
+	handler Handler
+}
+
+// A Watcher reloads assets when their files change. It watches the directories
+// assets live in rather than the files themselves, because editors which save
+// by writing a new file and renaming it over the old one would otherwise leave
+// us watching a file that no longer exists.
+//
+// Handlers are called from the watcher's own goroutine, so anything touching
+// OpenGL has to be passed back to the main thread.
+type Watcher struct{
+	watcher *fsnotify.Watcher
+	delay time.Duration
+
+	lock sync.Mutex
+	handlers map[string][]watched
+	directories map[string]int
+	nextId int
+
+	done chan bool
+	stopped sync.WaitGroup
+	closeOnce sync.Once
+}
+
+func New(delay time.Duration) (*Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	self := &Watcher{
+		watcher: watcher,
+		delay: delay,
+		handlers: make(map[string][]watched),
+		directories: make(map[string]int),
+		done: make(chan bool),
+	}
+
+	self.stopped.Add(1)
+	go self.run()
+
+	return self, nil
+}
+
+// Call handler whenever filename changes. A file can have any number of
+// handlers, and the handle returned removes just this one.
+func (self *Watcher) Watch(filename string, handler Handler) (Handle, error) {
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		return Handle{}, err
+	}
+	dir := filepath.Dir(path)
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.directories[dir] == 0 {
+		err := self.watcher.Add(dir)
+		if err != nil {
+			return Handle{}, err
+		}
+	}
+	self.directories[dir] += 1
+	self.nextId += 1
+	self.handlers[path] = append(self.handlers[path], watched{self.nextId, handler})
+
+	return Handle{path: path, id: self.nextId}, nil
+}
+
+// Stop calling the handler a call to Watch added. The directory stops being
+// watched once none of its files have handlers left.
+func (self *Watcher) Unwatch(handle Handle) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	handlers := self.handlers[handle.path]
+	found := false
+	for i, w := range(handlers) {
+		if w.id == handle.id {
+			handlers = append(handlers[:i:i], handlers[i+1:]...)
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil
+	}
+	if len(handlers) == 0 {
+		delete(self.handlers, handle.path)
+	} else {
+		self.handlers[handle.path] = handlers
+	}
+
+	dir := filepath.Dir(handle.path)
+	self.directories[dir] -= 1
+	if self.directories[dir] <= 0 {
+		delete(self.directories, dir)
+		return self.watcher.Remove(dir)
+	}
+
+	return nil
+}
+
+// Stop watching everything. Handlers which are already running are waited
+// for, and no more will be called once this returns.
+func (self *Watcher) Close() error {
+	var err error
+	self.closeOnce.Do(func() {
+		close(self.done)
+		self.stopped.Wait()
+		err = self.watcher.Close()
+	})
+	return err
+}
+
+func (self *Watcher) run() {
+	defer self.stopped.Done()
+
+	// Files which have changed, and when they'll have been quiet for long
+	// enough to load.
+	pending := make(map[string]time.Time)
+	timer := time.NewTimer(self.delay)
+	timer.Stop()
+
+	for {
+		select {
+		case event, ok := <-self.watcher.Events:
+			if !ok {
+				return
+			}
+			path := filepath.Clean(event.Name)
+			if !self.watching(path) {
+				continue
+			}
+			pending[path] = time.Now().Add(self.delay)
+			timer.Reset(self.delay)
+
+		case err, ok := <-self.watcher.Errors:
+			if !ok {
+				return
+			}
+			fmt.Println("watch:", err)
+
+		case <-timer.C:
+			now := time.Now()
+			var wait time.Duration
+			for path, ready := range(pending) {
+				if ready.After(now) {
+					if wait == 0 || ready.Sub(now) < wait {
+						wait = ready.Sub(now)
+					}
+					continue
+				}
+				delete(pending, path)
+				self.dispatch(path)
+			}
+			if wait > 0 {
+				timer.Reset(wait)
+			}
+
+		case <-self.done:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+func (self *Watcher) watching(path string) bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return len(self.handlers[path]) > 0
+}
+
+func (self *Watcher) dispatch(path string) {
+	// A file which was removed or renamed away will usually be back soon, and
+	// we'll hear about it when it is.
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+
+	self.lock.Lock()
+	handlers := append([]watched{}, self.handlers[path]...)
+	self.lock.Unlock()
+
+	for _, w := range(handlers) {
+		w.handler(path)
+	}
+}
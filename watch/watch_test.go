@@ -0,0 +1,77 @@
+package watch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Removing one of a file's handlers leaves the others called, and the
+// directory is only let go of once the last is removed.
+func TestUnwatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "texture.png")
+	err = ioutil.WriteFile(filename, []byte("before"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	watcher, err := New(10 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+
+	removed := make(chan string, 10)
+	kept := make(chan string, 10)
+	first, err := watcher.Watch(filename, func(path string) { removed <- path })
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := watcher.Watch(filename, func(path string) { kept <- path })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = watcher.Unwatch(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filename, []byte("after"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-kept:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the remaining handler wasn't called")
+	}
+	select {
+	case <-removed:
+		t.Error("the removed handler was called")
+	default:
+	}
+
+	// Removing a handler twice does nothing
+	err = watcher.Unwatch(first)
+	if err != nil {
+		t.Error(err)
+	}
+	if count := watcher.directories[dir]; count != 1 {
+		t.Errorf("directory has %v handlers, expected 1", count)
+	}
+	err = watcher.Unwatch(second)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(watcher.directories) != 0 || len(watcher.handlers) != 0 {
+		t.Errorf("still watching %v for %v", watcher.directories, watcher.handlers)
+	}
+}